@@ -1,9 +1,73 @@
 package config
 
+import (
+	"os"
+	"time"
+)
+
 const (
-	MySQLDSN          = "root:Boppudi@2002@tcp(127.0.0.1:3306)/notify"
+	MySQLDSN          = "root:Boppudi@2002@tcp(127.0.0.1:3306)/notify?parseTime=true"
 	RedisAddr         = "localhost:6379"
 	KafkaAddr         = "localhost:9092"
 	KafkaTopic        = "SMS"
 	ElasticsearchAddr = "http://localhost:9200"
 )
+
+// Elasticsearch SMS indices. Each period gets its own index; searches go
+// through the read alias, which covers every period, and new documents through
+// the write alias, which points at the current period only.
+const (
+	ElasticsearchSMSAlias        = "sms"
+	ElasticsearchSMSWriteAlias   = "sms-write"
+	ElasticsearchIndexPeriod     = "monthly"
+	ElasticsearchRetention       = 365 * 24 * time.Hour
+	ElasticsearchRetentionAction = "delete"
+	ElasticsearchLifecycleEvery  = time.Hour
+	// How long an instance may hold the lock of a mapping migration before
+	// another instance may take it over
+	ElasticsearchMigrationLease = 6 * time.Hour
+)
+
+// Asynchronous SMS indexing. Documents are sent to Elasticsearch in bulk
+// batches; batches that still fail after the retries are kept in the MySQL
+// backlog, which is retried every ElasticsearchBacklogEvery.
+const (
+	ElasticsearchBulkSize      = 500
+	ElasticsearchFlushInterval = time.Second
+	ElasticsearchQueueSize     = 10000
+	ElasticsearchRetryAttempts = 3
+	ElasticsearchRetryBackoff  = 500 * time.Millisecond
+	ElasticsearchBacklogEvery  = 30 * time.Second
+)
+
+// Topic blacklist.added and blacklist.removed events are published to
+const KafkaBlacklistEventsTopic = "blacklist-events"
+
+// Kafka producer delivery settings
+const (
+	KafkaMaxDeliveryRetries = 3
+	KafkaRetryBackoff       = 2 * time.Second
+	KafkaFlushTimeoutMs     = 15000
+	// How long an instance holds the blacklist events it produces before
+	// another instance may publish them; longer than librdkafka's 5 minute
+	// delivery timeout
+	BlacklistEventClaimLease = 10 * time.Minute
+)
+
+// Number of workers ProcessMessages uses. Messages sharing a Kafka key are
+// always handled by the same worker, in the order they were consumed.
+const MessageProcessingWorkers = 8
+
+// API key authentication
+const (
+	APIKeyHeader = "X-API-Key"
+	// BootstrapAPIKeyEnv names the environment variable holding an operator
+	// API key that is registered on startup, so the first real keys can be
+	// issued.
+	BootstrapAPIKeyEnv = "NOTIFY_BOOTSTRAP_API_KEY"
+)
+
+// AllowlistMode restricts sending to numbers on the tenant's allowlist. It is
+// switched on per environment with NOTIFY_ALLOWLIST_MODE=true, so staging can
+// never text real customers.
+var AllowlistMode = os.Getenv("NOTIFY_ALLOWLIST_MODE") == "true"
@@ -0,0 +1,44 @@
+package initations
+
+import (
+	"flag"
+	"fmt"
+
+	service "notifications/internal/pkg/service"
+)
+
+// RunBackfill indexes the SMS of MySQL in Elasticsearch from the command line
+// and prints the progress after every batch. It returns the exit code.
+//
+//	notifications backfill [-target index] [-resume] [-compare]
+func RunBackfill(args []string) int {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	var request service.BackfillRequest
+	flags.StringVar(&request.Target, "target", "", "index to fill; the period indices if empty")
+	flags.BoolVar(&request.Resume, "resume", false, "continue after the checkpoint of the last run")
+	flags.BoolVar(&request.Compare, "compare", false, "report days whose counts differ from MySQL")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	backfill, err := service.OpenBackfillService()
+	if err != nil {
+		fmt.Printf("Backfill failed: %v\n", err)
+		return 1
+	}
+	job, err := backfill.RunBackfill(request, func(job service.BackfillJob) {
+		fmt.Printf("%d/%d processed, %d indexed, %d failed, checkpoint %s\n", job.Processed, job.Total, job.Indexed, job.Failed, job.LastID)
+	})
+	if err != nil {
+		fmt.Printf("Backfill failed: %v\n", err)
+		return 1
+	}
+	if request.Compare && len(job.Gaps) == 0 {
+		fmt.Println("Document counts match MySQL on every day")
+	}
+	for _, gap := range job.Gaps {
+		fmt.Printf("%s: %d in MySQL, %d in Elasticsearch\n", gap.Day, gap.MySQL, gap.Elasticsearch)
+	}
+	fmt.Printf("Backfill %s completed\n", job.ID)
+	return 0
+}
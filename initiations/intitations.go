@@ -1,12 +1,18 @@
 package initations
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	controllers "notifications/internal/pkg/controllers"
+	service "notifications/internal/pkg/service"
 
 	"github.com/gorilla/mux"
 )
@@ -16,42 +22,105 @@ func InitializeControllers() (
 	*controllers.MessageController,
 	*controllers.BlackListController,
 	*controllers.ElasticSearchController,
+	*controllers.AuthController,
+	*controllers.TenantController,
+	*controllers.AllowListController,
 ) {
 	messageController := controllers.GetMessageController()
 	blacklistController := controllers.GetBlackListController()
 	elasticSearchController := controllers.GetElasticController()
+	authController := controllers.GetAuthController()
+	tenantController := controllers.GetTenantController()
+	allowlistController := controllers.GetAllowListController()
 
-	return messageController, blacklistController, elasticSearchController
+	return messageController, blacklistController, elasticSearchController, authController, tenantController, allowlistController
 }
 
-// SetupRouter sets up the HTTP routes and starts the server.
+// SetupRouter sets up the HTTP routes.
 func SetupRouter(
 	MessageController *controllers.MessageController,
 	BlackListController *controllers.BlackListController,
 	ElasticsearchController *controllers.ElasticSearchController,
-) {
+	AuthController *controllers.AuthController,
+	TenantController *controllers.TenantController,
+	AllowListController *controllers.AllowListController,
+) *mux.Router {
 	r := mux.NewRouter()
+	r.Use(AuthController.Authenticate)
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return AuthController.RequireScope(service.ScopeAdmin, h)
+	}
+	sms := func(h http.HandlerFunc) http.HandlerFunc {
+		return AuthController.RequireScope(service.ScopeSMS, h)
+	}
+	// Routes acting on every tenant at once
+	operator := func(h http.HandlerFunc) http.HandlerFunc {
+		return AuthController.RequireScope(service.ScopeOperator, h)
+	}
 
 	// Define routes
-	r.HandleFunc("/blacklist", BlackListController.AddNumberToBlacklist).Methods("POST")
-	r.HandleFunc("/blacklist", BlackListController.GetAllFromBlackList).Methods("GET")
-	r.HandleFunc("/blacklist/{number}", BlackListController.DeleteNumberFromBlacklist).Methods("DELETE")
-	r.HandleFunc("/blacklist/{number}", BlackListController.GetBlacklistByID).Methods("GET")
-	r.HandleFunc("/sms/{ID}", MessageController.GetMessageByID).Methods("GET")
-	r.HandleFunc("/sms", MessageController.NotifyServer).Methods("POST")
-	r.HandleFunc("/sms", MessageController.GetAllMessages).Methods("GET")
-	r.HandleFunc("/notify", MessageController.SendMessageToUsers).Methods("GET")
-	r.HandleFunc("/elastic/{id}", ElasticsearchController.GetDocByID).Methods("GET")
-	r.HandleFunc("/elastic", ElasticsearchController.GetAllDocs).Methods("GET")
-	r.HandleFunc("/elastictext/{text}", ElasticsearchController.GetDocByText).Methods("GET")
-	r.HandleFunc("/elasticsearchbytime", ElasticsearchController.GetDocsByTimeRange).Methods("GET")
-	fmt.Println("Starting the server at :8000")
-	log.Println("Starting the server at :8000")
+	r.HandleFunc("/apikeys", admin(AuthController.CreateAPIKey)).Methods("POST")
+	r.HandleFunc("/tenants/{tenantID}", admin(TenantController.GetTenant)).Methods("GET")
+	r.HandleFunc("/tenants/{tenantID}", admin(TenantController.SaveTenant)).Methods("PUT")
+	r.HandleFunc("/blacklist", admin(BlackListController.AddNumberToBlacklist)).Methods("POST")
+	r.HandleFunc("/blacklist", sms(BlackListController.GetAllFromBlackList)).Methods("GET")
+	r.HandleFunc("/blacklist/rules", admin(BlackListController.AddBlacklistRule)).Methods("POST")
+	r.HandleFunc("/blacklist/rules", sms(BlackListController.GetBlacklistRules)).Methods("GET")
+	r.HandleFunc("/blacklist/rules/{id}", admin(BlackListController.DeleteBlacklistRule)).Methods("DELETE")
+	r.HandleFunc("/blacklist/import", admin(BlackListController.ImportBlacklist)).Methods("POST")
+	r.HandleFunc("/blacklist/export", admin(BlackListController.ExportBlacklist)).Methods("GET")
+	r.HandleFunc("/blacklist/stats", sms(BlackListController.GetBlacklistStats)).Methods("GET")
+	r.HandleFunc("/blacklist/reconcile", admin(BlackListController.ReconcileBlacklist)).Methods("GET")
+	r.HandleFunc("/blacklist/{number}", admin(BlackListController.DeleteNumberFromBlacklist)).Methods("DELETE")
+	r.HandleFunc("/blacklist/{number}", sms(BlackListController.GetBlacklistByID)).Methods("GET")
+	r.HandleFunc("/allowlist", admin(AllowListController.AddNumberToAllowlist)).Methods("POST")
+	r.HandleFunc("/allowlist", sms(AllowListController.GetAllFromAllowList)).Methods("GET")
+	r.HandleFunc("/allowlist/{number}", admin(AllowListController.DeleteNumberFromAllowlist)).Methods("DELETE")
+	r.HandleFunc("/allowlist/{number}", sms(AllowListController.GetAllowlistByID)).Methods("GET")
+	r.HandleFunc("/sms/replay", admin(MessageController.ReplayMessages)).Methods("POST")
+	r.HandleFunc("/sms/replay/{jobID}", admin(MessageController.GetReplayJob)).Methods("GET")
+	r.HandleFunc("/sms/{ID}", sms(MessageController.GetMessageByID)).Methods("GET")
+	r.HandleFunc("/sms", sms(MessageController.NotifyServer)).Methods("POST")
+	r.HandleFunc("/sms", sms(MessageController.GetAllMessages)).Methods("GET")
+	r.HandleFunc("/notify", admin(MessageController.SendMessageToUsers)).Methods("GET")
+	r.HandleFunc("/elastic/backfill", operator(ElasticsearchController.StartBackfill)).Methods("POST")
+	r.HandleFunc("/elastic/backfill/{jobID}", operator(ElasticsearchController.GetBackfillJob)).Methods("GET")
+	r.HandleFunc("/elastic/{id}", sms(ElasticsearchController.GetDocByID)).Methods("GET")
+	r.HandleFunc("/elastic", sms(ElasticsearchController.GetAllDocs)).Methods("GET")
+	r.HandleFunc("/elastictext/{text}", sms(ElasticsearchController.GetDocByText)).Methods("GET")
+	r.HandleFunc("/elasticsearchbytime", sms(ElasticsearchController.GetDocsByTimeRange)).Methods("GET")
+	r.HandleFunc("/search/sms", sms(ElasticsearchController.SearchSMS)).Methods("GET")
+	r.HandleFunc("/analytics/sms", sms(ElasticsearchController.GetSMSAnalytics)).Methods("GET")
+	return r
+}
 
-	err := http.ListenAndServe(":8000", r)
-	if err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+// RunServer starts the HTTP server and blocks until SIGINT or SIGTERM is
+// received. It then stops accepting requests and flushes the Kafka producers so
+// that every accepted SMS and blacklist event reaches Kafka before the process exits.
+func RunServer(r *mux.Router, messageController *controllers.MessageController, blacklistController *controllers.BlackListController) {
+	srv := &http.Server{Addr: ":8000", Handler: r}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		fmt.Println("Starting the server at :8000")
+		log.Println("Starting the server at :8000")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down the server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
 	}
+	messageController.MessageService.Close()
+	blacklistController.Close()
 }
 
 // StartServer initializes all controllers, and starts the HTTP server.
@@ -62,6 +131,7 @@ func StartServer() {
 	}
 	defer file.Close()
 	log.SetOutput(file)
-	messageController, blacklistController, elasticSearchController := InitializeControllers()
-	SetupRouter(messageController, blacklistController, elasticSearchController)
+	messageController, blacklistController, elasticSearchController, authController, tenantController, allowlistController := InitializeControllers()
+	r := SetupRouter(messageController, blacklistController, elasticSearchController, authController, tenantController, allowlistController)
+	RunServer(r, messageController, blacklistController)
 }
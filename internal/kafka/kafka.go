@@ -8,6 +8,7 @@ import (
 
 type Producer = kafka.Producer
 type Consumer = kafka.Consumer
+type Message = kafka.Message
 
 func NewConsumer(brokers, groupID string) (*Consumer, error) {
 	log.Println("returning new consumer of kafka")
@@ -18,10 +19,13 @@ func NewConsumer(brokers, groupID string) (*Consumer, error) {
 	})
 }
 
+// NewProducer returns an idempotent producer: librdkafka's own retries can
+// neither duplicate nor reorder the messages of a partition.
 func NewProducer(brokers string) (*Producer, error) {
 	log.Println("returning new producer of kafka")
 	return kafka.NewProducer(&kafka.ConfigMap{
-		"bootstrap.servers": brokers,
+		"bootstrap.servers":  brokers,
+		"enable.idempotence": true,
 	})
 }
 func GetKafkaProducer()(*kafka.Producer,error){
@@ -40,3 +44,17 @@ func GetKafkaConsumer()(*kafka.Consumer,error){
 	}
 	return consumer,nil
 }
+
+// HandleDeliveryReports drains the producer's event channel and passes every
+// delivery report to onReport. It returns once the producer is closed.
+func HandleDeliveryReports(producer *Producer, onReport func(*Message)) {
+	for e := range producer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			onReport(ev)
+		case kafka.Error:
+			log.Printf("HandleDeliveryReports: Kafka producer error: %v", ev)
+		}
+	}
+	log.Println("HandleDeliveryReports: producer events channel closed")
+}
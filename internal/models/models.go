@@ -11,6 +11,10 @@ type SMS struct {
 	Status          string
 	FailureCode     string
 	FailureComments string
+	OrderingKey     string
+	ClientID        string `gorm:"index"`
+	TenantID        string `gorm:"index;size:64"`
+	SenderID        string
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 }
@@ -18,3 +22,106 @@ type SMS struct {
 type Number struct {
 	PhoneNumber string `json:"PhoneNumber"`
 }
+
+// APIKey is a hashed API key issued to a client. Scopes is a comma separated
+// list such as "sms,admin".
+type APIKey struct {
+	ID        uint   `gorm:"primaryKey"`
+	ClientID  string `gorm:"index;size:64"`
+	TenantID  string `gorm:"size:64"`
+	KeyHash   string `gorm:"uniqueIndex;size:64"`
+	Scopes    string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// Tenant holds the per-tenant settings. SenderIDs is a comma separated list of
+// the sender IDs the tenant may use; the first one is the default. A
+// DailyQuota of 0 means unlimited.
+type Tenant struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	Name       string
+	SenderIDs  string
+	DailyQuota int
+	WebhookURL string
+	// RejectBlacklisted rejects SMS to blacklisted numbers at submission
+	// instead of storing them and failing them during processing
+	RejectBlacklisted bool
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// BlacklistEntry is the persisted form of a blacklisted number. MySQL is the
+// source of truth; the Redis blacklist sets are rebuilt from this table.
+// Entries with an ExpiresAt in the past no longer block.
+type BlacklistEntry struct {
+	ID          uint       `gorm:"primaryKey" json:"-"`
+	TenantID    string     `gorm:"uniqueIndex:idx_blacklist_tenant_number;size:64" json:"-"`
+	PhoneNumber string     `gorm:"uniqueIndex:idx_blacklist_tenant_number;size:32" json:"number"`
+	Reason      string     `json:"reason"`
+	Source      string     `json:"source"`
+	AddedBy     string     `json:"added_by"`
+	CreatedAt   time.Time  `json:"added_at"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expires_at,omitempty"`
+}
+
+// IsExpired reports whether the entry's expiry has passed.
+func (e *BlacklistEntry) IsExpired(now time.Time) bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(now)
+}
+
+// BlacklistRule blocks a whole group of numbers: every number starting with
+// Prefix for prefix rules, or every number of the same length between
+// RangeStart and RangeEnd (inclusive) for range rules.
+type BlacklistRule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TenantID   string    `gorm:"index;size:64" json:"-"`
+	Type       string    `json:"type"`
+	Prefix     string    `json:"prefix,omitempty"`
+	RangeStart string    `json:"range_start,omitempty"`
+	RangeEnd   string    `json:"range_end,omitempty"`
+	Reason     string    `json:"reason"`
+	AddedBy    string    `json:"added_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// BlacklistEvent is an outbox row for a blacklist change. It is written in the
+// same transaction as the change and published to Kafka afterwards, so no
+// change is lost if Kafka is briefly unavailable.
+type BlacklistEvent struct {
+	ID          uint       `gorm:"primaryKey" json:"event_id"`
+	Type        string     `json:"type"`
+	TenantID    string     `gorm:"size:64" json:"tenant_id"`
+	PhoneNumber string     `json:"number"`
+	Reason      string     `json:"reason,omitempty"`
+	Actor       string     `json:"actor"`
+	CreatedAt   time.Time  `json:"occurred_at"`
+	PublishedAt *time.Time `gorm:"index" json:"-"`
+	// The instance relaying the event, until ClaimedUntil
+	ClaimedBy    string     `gorm:"size:255" json:"-"`
+	ClaimedUntil *time.Time `json:"-"`
+}
+
+// SMSIndexBacklog holds an SMS document that could not be indexed in
+// Elasticsearch, to be retried later. Document is the JSON source and Version
+// its external document version; partial documents are status updates. Index
+// is the period index of full documents; partial documents are looked up
+// again when retried.
+type SMSIndexBacklog struct {
+	ID        uint   `gorm:"primaryKey"`
+	SMSID     string `gorm:"size:64;index"`
+	Index     string `gorm:"size:255"`
+	Version   int64
+	Partial   bool
+	Document  string `gorm:"type:text"`
+	CreatedAt time.Time
+}
+
+// BackfillCheckpoint records how far the last backfill of an Elasticsearch
+// target got. SMS are backfilled in ID order, so a resumed run continues
+// after LastID.
+type BackfillCheckpoint struct {
+	Target    string `gorm:"primaryKey;size:255"`
+	LastID    string
+	UpdatedAt time.Time
+}
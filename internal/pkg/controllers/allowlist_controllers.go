@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	service "notifications/internal/pkg/service"
+
+	"github.com/gorilla/mux"
+)
+
+// Define constants for response messages
+const (
+	AllowlistedStatus       = "allowlisted"
+	AllowlistRemovedMessage = "Successfully removed from allowlist"
+)
+
+type AllowlistStatusResponse struct {
+	Data struct {
+		Number string `json:"number"`
+		Status string `json:"status"`
+	} `json:"data"`
+}
+
+type AllowListController struct {
+	allowlistService *service.AllowlistService
+}
+
+func GetAllowListController() *AllowListController {
+	return &AllowListController{allowlistService: service.GetAllowlistService()}
+}
+
+func (h *AllowListController) GetAllFromAllowList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	allowlist, err := h.allowlistService.GetAllFromAllowlist(ctx, service.TenantFromContext(ctx))
+	if err != nil {
+		writeError(w, err, "GetAllFromAllowlist")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(SuccessResponseList{Data: allowlist}); err != nil {
+		handleEncodingError(w, err, "GetAllFromAllowlist")
+	}
+}
+
+func (h *AllowListController) AddNumberToAllowlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	var request struct {
+		Numbers []string `json:"numbers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		handleInvalidRequest(w, err, "AddAllowlistNumbers")
+		return
+	}
+
+	success, already, err := h.allowlistService.AddToAllowlist(ctx, service.TenantFromContext(ctx), request.Numbers)
+	if err != nil {
+		writeError(w, err, "AddAllowlistNumbers")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": success,
+		"already": already,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		handleEncodingError(w, err, "AddAllowlistNumbers")
+	}
+}
+
+func (h *AllowListController) DeleteNumberFromAllowlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	number := mux.Vars(r)["number"]
+
+	if err := h.allowlistService.RemoveFromAllowlist(ctx, service.TenantFromContext(ctx), number); err != nil {
+		writeError(w, err, "DeleteFromAllowlist")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(SuccessResponse{Data: AllowlistRemovedMessage}); err != nil {
+		handleEncodingError(w, err, "DeleteFromAllowlist")
+	}
+}
+
+func (h *AllowListController) GetAllowlistByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	number := mux.Vars(r)["number"]
+
+	isAllowlisted, err := h.allowlistService.IsNumberAllowlisted(ctx, service.TenantFromContext(ctx), number)
+	if err != nil {
+		writeError(w, err, "GetAllowlistByID")
+		return
+	}
+	if !isAllowlisted {
+		writeError(w, fmt.Errorf("%w: number %s is not allowlisted", service.ErrNotFound, number), "GetAllowlistByID")
+		return
+	}
+
+	var response AllowlistStatusResponse
+	response.Data.Number = number
+	response.Data.Status = AllowlistedStatus
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		handleEncodingError(w, err, "GetAllowlistByID")
+	}
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	config "notifications/configurations"
+	service "notifications/internal/pkg/service"
+)
+
+type CreateAPIKeyResponse struct {
+	Data struct {
+		ClientID string   `json:"client_id"`
+		TenantID string   `json:"tenant_id"`
+		APIKey   string   `json:"api_key"`
+		Scopes   []string `json:"scopes"`
+	} `json:"data"`
+}
+
+// AuthController authenticates requests and manages API keys
+type AuthController struct {
+	authService *service.AuthService
+}
+
+func GetAuthController() *AuthController {
+	return &AuthController{authService: service.GetAuthService()}
+}
+
+// Authenticate is a middleware that rejects requests without a valid API key
+// and stores the caller's identity in the request context.
+func (h *AuthController) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeJSON)
+
+		client, err := h.authService.Authenticate(r.Header.Get(config.APIKeyHeader))
+		if err != nil {
+			writeError(w, err, "Authenticate")
+			return
+		}
+		if client == nil {
+			writeError(w, fmt.Errorf("%w: missing or invalid API key for %s %s", service.ErrUnauthorized, r.Method, r.URL.Path), "Authenticate")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(service.ContextWithClient(r.Context(), client)))
+	})
+}
+
+// RequireScope wraps a handler so it only runs for clients granted scope.
+// It must run behind Authenticate.
+func (h *AuthController) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, ok := service.ClientFromContext(r.Context())
+		if !ok || !client.HasScope(scope) {
+			w.Header().Set("Content-Type", ContentTypeJSON)
+			writeError(w, fmt.Errorf("%w: API key does not have the %s scope", service.ErrForbidden, scope), "RequireScope")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkTenant returns ErrForbidden unless the authenticated client may act on
+// tenantID.
+func checkTenant(r *http.Request, tenantID string) error {
+	client, ok := service.ClientFromContext(r.Context())
+	if !ok {
+		return fmt.Errorf("%w: no authenticated client", service.ErrForbidden)
+	}
+	return client.CheckTenant(tenantID)
+}
+
+// CreateAPIKey issues a new API key, for the caller's tenant unless the
+// caller is an operator. The key is only returned once.
+func (h *AuthController) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+
+	var request struct {
+		ClientID string   `json:"client_id"`
+		TenantID string   `json:"tenant_id"`
+		Scopes   []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		handleInvalidRequest(w, err, "CreateAPIKey")
+		return
+	}
+	if request.ClientID == "" {
+		writeError(w, fmt.Errorf("%w: client_id is required", service.ErrValidation), "CreateAPIKey")
+		return
+	}
+	client, _ := service.ClientFromContext(r.Context())
+	if request.TenantID == "" {
+		request.TenantID = client.TenantID
+	}
+	if err := client.CheckTenant(request.TenantID); err != nil {
+		writeError(w, err, "CreateAPIKey")
+		return
+	}
+	if len(request.Scopes) == 0 {
+		request.Scopes = []string{service.ScopeSMS}
+	}
+	for _, scope := range request.Scopes {
+		if !client.HasScope(scope) {
+			writeError(w, fmt.Errorf("%w: granting the %s scope requires it", service.ErrForbidden, scope), "CreateAPIKey")
+			return
+		}
+	}
+
+	apiKey, err := h.authService.CreateAPIKey(request.ClientID, request.TenantID, request.Scopes)
+	if err != nil {
+		writeError(w, err, "CreateAPIKey")
+		return
+	}
+
+	var response CreateAPIKeyResponse
+	response.Data.ClientID = request.ClientID
+	response.Data.TenantID = request.TenantID
+	response.Data.APIKey = apiKey
+	response.Data.Scopes = request.Scopes
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("CreateAPIKey: %v", err)
+	}
+}
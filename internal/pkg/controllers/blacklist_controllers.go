@@ -2,9 +2,14 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"notifications/internal/models"
 	service "notifications/internal/pkg/service"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -13,26 +18,29 @@ import (
 const (
 	BlacklistedStatus         = "blacklisted"
 	NotBlacklistedStatus      = "not blacklisted"
-	NumberNotFoundError       = "Number does not exist"
-	NumberNotBlacklistedError = "Number is not blacklisted"
-	InternalError             = "Internal error occurred"
-	InvalidRequestError       = "Invalid request"
 	SuccessMessage            = "Successfully removed from blacklist"
+	defaultBlacklistPageSize  = 100
+	maxBlacklistPageSize      = 1000
+	defaultBlacklistStatsTop  = 10
+	defaultBlacklistStatsDays = 7
+	maxBlacklistStatsDays     = 90
+	RuleDeletedMessage        = "Successfully deleted blacklist rule"
 )
 
 // Define response structs
-type ErrorResponseBlacklist struct {
-	Error struct {
-		Code    string `json:"code"`
-		Message string `json:"message"`
-	} `json:"error"`
+type BlacklistStatus struct {
+	Number    string     `json:"number"`
+	Status    string     `json:"status"`
+	Reason    string     `json:"reason"`
+	Source    string     `json:"source"`
+	AddedBy   string     `json:"added_by"`
+	AddedAt   time.Time  `json:"added_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastHitAt *time.Time `json:"last_hit_at,omitempty"`
 }
 
 type StatusResponse struct {
-	Data struct {
-		Number string `json:"number"`
-		Status string `json:"status"`
-	} `json:"data"`
+	Data BlacklistStatus `json:"data"`
 }
 
 type SuccessResponse struct {
@@ -43,10 +51,44 @@ type SuccessResponseList struct {
 	Data []string `json:"data"`
 }
 
+type PaginatedResponseList struct {
+	Data       []string `json:"data"`
+	NextCursor string   `json:"next_cursor"`
+	Total      int64    `json:"total"`
+}
+
+type BlacklistRuleResponse struct {
+	Data *models.BlacklistRule `json:"data"`
+}
+
+type BlacklistRuleListResponse struct {
+	Data []models.BlacklistRule `json:"data"`
+}
+
+type BlacklistImportResponse struct {
+	Data *service.BlacklistImportReport `json:"data"`
+}
+
+type BlacklistStatsResponse struct {
+	Data struct {
+		TopBlocked []service.BlacklistHitCount `json:"top_blocked"`
+		Daily      []service.DailyBlockedCount `json:"daily"`
+	} `json:"data"`
+}
+
+type BlacklistDriftResponse struct {
+	Data *service.BlacklistDrift `json:"data"`
+}
+
 type BlackListController struct {
 	blacklistService *service.BlacklistService
 }
 
+// Close flushes pending blacklist events on shutdown
+func (h *BlackListController) Close() {
+	h.blacklistService.Close()
+}
+
 
 // Handler functions
 func GetBlackListController()*BlackListController{
@@ -57,17 +99,37 @@ func (h *BlackListController) GetAllFromBlackList(w http.ResponseWriter, r *http
 	w.Header().Set("Content-Type", "application/json")
 
 	ctx := r.Context()
-	blacklist, err := h.blacklistService.GetAllFromBlacklist(ctx)
+	query := r.URL.Query()
+	limit := int64(defaultBlacklistPageSize)
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 || parsed > maxBlacklistPageSize {
+			handleInvalidRequest(w, fmt.Errorf("limit must be between 1 and %d", maxBlacklistPageSize), "GetAllFromBlacklist")
+			return
+		}
+		limit = parsed
+	}
+	cursor := query.Get("cursor")
+	if cursor != "" {
+		if _, err := strconv.ParseUint(cursor, 10, 64); err != nil {
+			handleInvalidRequest(w, fmt.Errorf("invalid cursor %q", cursor), "GetAllFromBlacklist")
+			return
+		}
+	}
+
+	page, err := h.blacklistService.ListBlacklist(ctx, service.TenantFromContext(ctx), cursor, limit, query.Get("prefix"))
 	if err != nil {
-		handleinternalErrorBlacklist(w, err, "GetAllFromBlacklist")
+		writeError(w, err, "GetAllFromBlacklist")
 		return
 	}
 
-	response := SuccessResponseList{
-		Data: blacklist,
+	response := PaginatedResponseList{
+		Data:       page.Numbers,
+		NextCursor: page.NextCursor,
+		Total:      page.Total,
 	}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		handleEncodingErrorBlacklist(w, err, "GetAllFromBlacklist")
+		handleEncodingError(w, err, "GetAllFromBlacklist")
 	}
 }
 
@@ -75,7 +137,10 @@ func (h *BlackListController) AddNumberToBlacklist(w http.ResponseWriter, r *htt
 	w.Header().Set("Content-Type", "application/json")
 
 	var request struct {
-		Numbers []string `json:"numbers"`
+		Numbers   []string   `json:"numbers"`
+		Reason    string     `json:"reason"`
+		Source    string     `json:"source"`
+		ExpiresAt *time.Time `json:"expires_at"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -83,9 +148,23 @@ func (h *BlackListController) AddNumberToBlacklist(w http.ResponseWriter, r *htt
 		return
 	}
 
-	success, already, err := h.blacklistService.AddToBlacklist(request.Numbers)
+	metadata := service.BlacklistMetadata{
+		Reason:    request.Reason,
+		Source:    request.Source,
+		ExpiresAt: request.ExpiresAt,
+	}
+	if client, ok := service.ClientFromContext(r.Context()); ok {
+		metadata.AddedBy = client.ClientID
+	}
+	if err := metadata.Validate(); err != nil {
+		writeError(w, err, "AddBlacklistNumbers")
+		return
+	}
+
+	tenantID := service.TenantFromContext(r.Context())
+	success, already, err := h.blacklistService.AddToBlacklist(tenantID, request.Numbers, metadata)
 	if err != nil {
-		handleinternalErrorBlacklist(w, err, "AddBlacklistNumbers")
+		writeError(w, err, "AddBlacklistNumbers")
 		return
 	}
 
@@ -94,7 +173,7 @@ func (h *BlackListController) AddNumberToBlacklist(w http.ResponseWriter, r *htt
 		"already": already,
 	}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		handleEncodingErrorBlacklist(w, err, "AddBlacklistNumbers")
+		handleEncodingError(w, err, "AddBlacklistNumbers")
 	}
 }
 
@@ -103,9 +182,13 @@ func (h *BlackListController) DeleteNumberFromBlacklist(w http.ResponseWriter, r
 	vars := mux.Vars(r)
 	number := vars["number"]
 
-	err := h.blacklistService.RemoveFromBlacklist(number)
+	actor := ""
+	if client, ok := service.ClientFromContext(r.Context()); ok {
+		actor = client.ClientID
+	}
+	err := h.blacklistService.RemoveFromBlacklist(service.TenantFromContext(r.Context()), number, actor)
 	if err != nil {
-		handleBlacklistRemovalError(w, err, number)
+		writeError(w, err, "DeleteFromBlacklist")
 		return
 	}
 
@@ -113,7 +196,7 @@ func (h *BlackListController) DeleteNumberFromBlacklist(w http.ResponseWriter, r
 		Data: SuccessMessage,
 	}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		handleEncodingErrorBlacklist(w, err, "DeleteFromBlacklist")
+		handleEncodingError(w, err, "DeleteFromBlacklist")
 	}
 }
 
@@ -123,127 +206,245 @@ func (h *BlackListController) GetBlacklistByID(w http.ResponseWriter, r *http.Re
 	number := vars["number"]
 	ctx := r.Context()
 
-	isBlacklisted, err := h.blacklistService.IsNumberBlacklisted(ctx, number)
+	tenantID := service.TenantFromContext(ctx)
+	entry, err := h.blacklistService.GetBlacklistEntry(tenantID, number)
 	if err != nil {
-		handleinternalErrorBlacklist(w, err, "GetBlacklistByID")
+		writeError(w, err, "GetBlacklistByID")
 		return
 	}
-
-	if !isBlacklisted {
-		handleNotFoundBlacklist(w, number, "GetBlacklistByID", NumberNotBlacklistedError)
+	lastHitAt, err := h.blacklistService.LastHitAt(ctx, tenantID, entry.PhoneNumber)
+	if err != nil {
+		writeError(w, err, "GetBlacklistByID")
 		return
 	}
 
 	response := StatusResponse{
-		Data: struct {
-			Number string `json:"number"`
-			Status string `json:"status"`
-		}{
-			Number: number,
-			Status: BlacklistedStatus,
+		Data: BlacklistStatus{
+			Number:    entry.PhoneNumber,
+			Status:    BlacklistedStatus,
+			Reason:    entry.Reason,
+			Source:    entry.Source,
+			AddedBy:   entry.AddedBy,
+			AddedAt:   entry.CreatedAt,
+			ExpiresAt: entry.ExpiresAt,
+			LastHitAt: lastHitAt,
 		},
 	}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		handleEncodingErrorBlacklist(w, err, "GetBlacklistByID")
+		handleEncodingError(w, err, "GetBlacklistByID")
 	}
 }
 
-// Helper functions
-func handleinternalErrorBlacklist(w http.ResponseWriter, err error, method string) {
-	log.Printf("%s: Error: %v", method, err)
-	http.Error(w, encodeJSON(ErrorResponseBlacklist{
-		Error: struct {
-			Code    string `json:"code"`
-			Message string `json:"message"`
-		}{
-			Code:    "INTERNAL_ERROR",
-			Message: InternalError,
-		},
-	}), http.StatusInternalServerError)
+// GetBlacklistStats reports the blacklisted numbers with the most blocked
+// sends (?limit=, default 10) and the sends blocked by entries or rules on
+// each of the last ?days= days (default 7).
+func (h *BlackListController) GetBlacklistStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	limit := int64(defaultBlacklistStatsTop)
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 || parsed > maxBlacklistPageSize {
+			handleInvalidRequest(w, fmt.Errorf("limit must be between 1 and %d", maxBlacklistPageSize), "GetBlacklistStats")
+			return
+		}
+		limit = parsed
+	}
+	days := defaultBlacklistStatsDays
+	if raw := query.Get("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxBlacklistStatsDays {
+			handleInvalidRequest(w, fmt.Errorf("days must be between 1 and %d", maxBlacklistStatsDays), "GetBlacklistStats")
+			return
+		}
+		days = parsed
+	}
+
+	tenantID := service.TenantFromContext(ctx)
+	var response BlacklistStatsResponse
+	var err error
+	if response.Data.TopBlocked, err = h.blacklistService.TopBlockedNumbers(ctx, tenantID, limit); err != nil {
+		writeError(w, err, "GetBlacklistStats")
+		return
+	}
+	if response.Data.Daily, err = h.blacklistService.DailyBlockedCounts(ctx, tenantID, days); err != nil {
+		writeError(w, err, "GetBlacklistStats")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		handleEncodingError(w, err, "GetBlacklistStats")
+	}
 }
 
-func handleInvalidRequest(w http.ResponseWriter, err error, method string) {
-	log.Printf("%s: Invalid input: %v", method, err)
-	http.Error(w, encodeJSON(ErrorResponseBlacklist{
-		Error: struct {
-			Code    string `json:"code"`
-			Message string `json:"message"`
-		}{
-			Code:    "INVALID_REQUEST",
-			Message: InvalidRequestError,
-		},
-	}), http.StatusBadRequest)
+// ReconcileBlacklist reports drift between the MySQL and Redis blacklists.
+// With ?repair=true the Redis set is rebuilt from MySQL.
+func (h *BlackListController) ReconcileBlacklist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	repair := r.URL.Query().Get("repair") == "true"
+
+	drift, err := h.blacklistService.ReconcileBlacklist(ctx, service.TenantFromContext(ctx), repair)
+	if err != nil {
+		writeError(w, err, "ReconcileBlacklist")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(BlacklistDriftResponse{Data: drift}); err != nil {
+		handleEncodingError(w, err, "ReconcileBlacklist")
+	}
 }
 
-func handleBlacklistRemovalError(w http.ResponseWriter, err error, number string) {
-	var statusCode int
-	var errorResponse ErrorResponseBlacklist
-
-	switch err.Error() {
-	case NumberNotFoundError:
-		log.Printf("DeleteFromBlacklist: Number not found: %s", number)
-		statusCode = http.StatusNotFound
-		errorResponse = ErrorResponseBlacklist{
-			Error: struct {
-				Code    string `json:"code"`
-				Message string `json:"message"`
-			}{
-				Code:    "INVALID_REQUEST",
-				Message: NumberNotFoundError,
-			},
-		}
-	case NumberNotBlacklistedError:
-		log.Printf("DeleteFromBlacklist: Number not blacklisted: %s", number)
-		statusCode = http.StatusNotFound
-		errorResponse = ErrorResponseBlacklist{
-			Error: struct {
-				Code    string `json:"code"`
-				Message string `json:"message"`
-			}{
-				Code:    "INVALID_REQUEST",
-				Message: NumberNotBlacklistedError,
-			},
-		}
-	default:
-		log.Printf("DeleteFromBlacklist: Failed to remove number from blacklist: %v", err)
-		statusCode = http.StatusInternalServerError
-		errorResponse = ErrorResponseBlacklist{
-			Error: struct {
-				Code    string `json:"code"`
-				Message string `json:"message"`
-			}{
-				Code:    "INTERNAL_ERROR",
-				Message: InternalError,
-			},
-		}
+// AddBlacklistRule creates a prefix or range rule for the caller's tenant.
+func (h *BlackListController) AddBlacklistRule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	var request service.BlacklistRuleInput
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		handleInvalidRequest(w, err, "AddBlacklistRule")
+		return
+	}
+
+	addedBy := ""
+	if client, ok := service.ClientFromContext(ctx); ok {
+		addedBy = client.ClientID
+	}
+	rule, err := request.ToRule(service.TenantFromContext(ctx), addedBy)
+	if err != nil {
+		writeError(w, err, "AddBlacklistRule")
+		return
+	}
+
+	if err := h.blacklistService.CreateBlacklistRule(ctx, rule); err != nil {
+		writeError(w, err, "AddBlacklistRule")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(BlacklistRuleResponse{Data: rule}); err != nil {
+		handleEncodingError(w, err, "AddBlacklistRule")
 	}
-	http.Error(w, encodeJSON(errorResponse), statusCode)
 }
 
-func handleNotFoundBlacklist(w http.ResponseWriter, number string, method string, message string) {
-	log.Printf("%s: Number not blacklisted: %s", method, number)
-	http.Error(w, encodeJSON(ErrorResponseBlacklist{
-		Error: struct {
-			Code    string `json:"code"`
-			Message string `json:"message"`
-		}{
-			Code:    "INVALID_REQUEST",
-			Message: message,
-		},
-	}), http.StatusNotFound)
+// GetBlacklistRules lists the prefix and range rules of the caller's tenant.
+func (h *BlackListController) GetBlacklistRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rules, err := h.blacklistService.ListBlacklistRules(service.TenantFromContext(r.Context()))
+	if err != nil {
+		writeError(w, err, "GetBlacklistRules")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(BlacklistRuleListResponse{Data: rules}); err != nil {
+		handleEncodingError(w, err, "GetBlacklistRules")
+	}
 }
 
-func handleEncodingErrorBlacklist(w http.ResponseWriter, err error, method string) {
-	log.Printf("%s: Error encoding response: %v", method, err)
-	http.Error(w, encodeJSON(ErrorResponseBlacklist{
-		Error: struct {
-			Code    string `json:"code"`
-			Message string `json:"message"`
-		}{
-			Code:    "INTERNAL_ERROR",
-			Message: InternalError,
-		},
-	}), http.StatusInternalServerError)
+// DeleteBlacklistRule deletes one of the caller's tenant's rules.
+func (h *BlackListController) DeleteBlacklistRule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handleInvalidRequest(w, fmt.Errorf("invalid rule id %q", mux.Vars(r)["id"]), "DeleteBlacklistRule")
+		return
+	}
+
+	if err := h.blacklistService.DeleteBlacklistRule(ctx, service.TenantFromContext(ctx), uint(id)); err != nil {
+		writeError(w, err, "DeleteBlacklistRule")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(SuccessResponse{Data: RuleDeletedMessage}); err != nil {
+		handleEncodingError(w, err, "DeleteBlacklistRule")
+	}
+}
+
+// ImportBlacklist bulk adds numbers streamed in the request body as CSV or
+// NDJSON, chosen with ?format= or the Content-Type header. ?reason= and
+// ?source= apply to every line that doesn't carry its own reason.
+func (h *BlackListController) ImportBlacklist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	format := bulkFormat(r)
+	if format == "" {
+		handleInvalidRequest(w, fmt.Errorf("unknown import format"), "ImportBlacklist")
+		return
+	}
+
+	metadata := service.BlacklistMetadata{
+		Reason: r.URL.Query().Get("reason"),
+		Source: r.URL.Query().Get("source"),
+	}
+	if metadata.Source == "" {
+		metadata.Source = service.SourceAdmin
+	}
+	if client, ok := service.ClientFromContext(ctx); ok {
+		metadata.AddedBy = client.ClientID
+	}
+	if err := metadata.Validate(); err != nil {
+		writeError(w, err, "ImportBlacklist")
+		return
+	}
+
+	report, err := h.blacklistService.ImportBlacklist(ctx, service.TenantFromContext(ctx), r.Body, format, metadata)
+	if err != nil {
+		writeError(w, err, "ImportBlacklist")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(BlacklistImportResponse{Data: report}); err != nil {
+		handleEncodingError(w, err, "ImportBlacklist")
+	}
+}
+
+// ExportBlacklist streams the whole blacklist as CSV or NDJSON.
+func (h *BlackListController) ExportBlacklist(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = service.FormatCSV
+	}
+
+	switch format {
+	case service.FormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case service.FormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		handleInvalidRequest(w, fmt.Errorf("unknown export format %q", format), "ExportBlacklist")
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="blacklist.%s"`, format))
+
+	// Once streaming started the status can't change, so failures are only logged
+	if err := h.blacklistService.ExportBlacklist(service.TenantFromContext(r.Context()), format, w); err != nil {
+		log.Printf("ExportBlacklist: Error: %v", err)
+	}
+}
+
+// bulkFormat picks the import format from ?format= or the Content-Type header.
+func bulkFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if format == service.FormatCSV || format == service.FormatNDJSON {
+			return format
+		}
+		return ""
+	}
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return service.FormatCSV
+	case strings.HasPrefix(contentType, "application/x-ndjson"), strings.HasPrefix(contentType, "application/ndjson"):
+		return service.FormatNDJSON
+	}
+	return ""
 }
 
 func encodeJSON(v interface{}) string {
@@ -2,8 +2,13 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	config "notifications/configurations"
 	service "notifications/internal/pkg/service"
 	"time"
     
@@ -12,15 +17,19 @@ import (
 
 // Constants
 const (
-	contentTypeHeader     = "application/json"
-	internalErrorCode     = "INTERNAL_ERROR"
-	notFoundErrorCode     = "NOT_FOUND"
-	invalidRequestCode    = "INVALID_REQUEST"
-	internalErrorMessage  = "Failed to retrieve document"
-	notFoundErrorMessage  = "Document not found"
-	invalidRequestMessage = "Invalid JSON body"
-	missingIndexMessage   = "Index parameter is required"
-	encodingErrorMessage  = "Failed to encode response"
+	contentTypeHeader = "application/json"
+)
+
+// Page sizes of the search endpoints
+const (
+	defaultSearchPageSize = 100
+	maxSearchPageSize     = 1000
+)
+
+// Number of top recipients in analytics reports
+const (
+	defaultTopRecipients = 10
+	maxTopRecipients     = 100
 )
 
 // Response Structs
@@ -28,27 +37,36 @@ type getDocByIDResponse struct {
 	Data interface{} `json:"data"`
 }
 
-type getDocByTextResponse struct {
-	Data interface{} `json:"data"`
+type searchSMSResponse struct {
+	Data       []service.SMSHit `json:"data"`
+	Total      int64            `json:"total"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
 
-type getAllDocsResponse struct {
-	Data interface{} `json:"data"`
+type smsAnalyticsResponse struct {
+	Data *service.SMSAnalytics `json:"data"`
 }
 
-type searchByTimeRangeResponse struct {
-	Data interface{} `json:"data"`
+type backfillJobResponse struct {
+	Data service.BackfillJob `json:"data"`
+}
+
+type searchPageResponse struct {
+	Data       interface{} `json:"data"`
+	Total      int64       `json:"total"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 // Controller
 type ElasticSearchController struct {
 	elasticsearchService *service.ElasticsearchService
+	backfillService      *service.BackfillService
 }
 
 
 func GetElasticController() *ElasticSearchController{
 		elastic := service.GetElasticService()
-	return &ElasticSearchController{elasticsearchService: elastic}
+	return &ElasticSearchController{elasticsearchService: elastic, backfillService: service.GetBackfillService()}
 }
    
 // Handler functions
@@ -56,18 +74,13 @@ func (h *ElasticSearchController) GetDocByID(w http.ResponseWriter, r *http.Requ
 	w.Header().Set("Content-Type", contentTypeHeader)
 
 	vars := mux.Vars(r)
-	index := "sms_index"
+	index := config.ElasticsearchSMSAlias
 	id := vars["id"]
 	log.Printf("getDocByID: Received request for document with ID %s from index %s", id, index)
 
-	doc, err := h.elasticsearchService.GetDocumentByID(index, id)
+	doc, err := h.elasticsearchService.GetDocumentByID(service.TenantFromContext(r.Context()), index, id)
 	if err != nil {
-		handleInternalError(w, err, "getDocByID")
-		return
-	}
-
-	if doc == nil {
-		handleNotFound(w, id, index, "getDocByID")
+		writeError(w, err, "getDocByID")
 		return
 	}
 
@@ -81,22 +94,28 @@ func (h *ElasticSearchController) GetDocByText(w http.ResponseWriter, r *http.Re
 	w.Header().Set("Content-Type", contentTypeHeader)
     
 	vars := mux.Vars(r)
-	index := "sms_index"
+	index := config.ElasticsearchSMSAlias
 	text := vars["text"]
 	log.Printf("getDocByText: Received request for text '%s' from index %s", text, index)
 
-	docs, err := h.elasticsearchService.SearchByText(index, text)
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		writeError(w, err, "getDocByText")
+		return
+	}
+
+	page, err := h.elasticsearchService.SearchByText(service.TenantFromContext(r.Context()), index, text, limit, cursor)
 	if err != nil {
-		handleInternalError(w, err, "getDocByText")
+		writeError(w, err, "getDocByText")
 		return
 	}
 
-	if len(docs) == 0 {
-		handleNotFound(w, text, index, "getDocByText")
+	if page.Total == 0 {
+		writeError(w, fmt.Errorf("%w: no documents match %q", service.ErrNotFound, text), "getDocByText")
 		return
 	}
     
-	response := getDocByTextResponse{Data: docs}
+	response := searchPageResponse{Data: page.Hits, Total: page.Total, NextCursor: page.NextCursor}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		handleEncodingError(w, err, "getDocByText")
 	}
@@ -105,31 +124,20 @@ func (h *ElasticSearchController) GetDocByText(w http.ResponseWriter, r *http.Re
 func (h *ElasticSearchController) GetAllDocs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", contentTypeHeader)
  
-	var requestBody struct {
-		Index string `json:"index"`
-	}
-
-	// Decode the request body
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		log.Printf("getAllDocs: Error decoding request body: %v", err)
-		http.Error(w, `{"error":{"code":"INVALID_REQUEST","message":"Invalid JSON body"}}`, http.StatusBadRequest)
-		return
-	}
-
-	index := requestBody.Index
-	if index == "" {
-		http.Error(w, `{"error":{"code":"INVALID_REQUEST","message":"Index parameter is required"}}`, http.StatusBadRequest)
+	index := config.ElasticsearchSMSAlias
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		writeError(w, err, "getAllDocs")
 		return
 	}
 
-	docs, err := h.elasticsearchService.GetAllDocuments(index)
+	page, err := h.elasticsearchService.GetAllDocuments(service.TenantFromContext(r.Context()), index, limit, cursor)
 	if err != nil {
-		log.Printf("getAllDocs: Error retrieving documents from index %s: %v", index, err)
-		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to retrieve documents"}}`, http.StatusInternalServerError)
+		writeError(w, err, "getAllDocs")
 		return
 	}
 
-	response := getAllDocsResponse{Data: docs}
+	response := searchPageResponse{Data: page.Hits, Total: page.Total, NextCursor: page.NextCursor}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		handleEncodingError(w, err, "getAllDocs")
 	}
@@ -139,49 +147,218 @@ func (h *ElasticSearchController) GetDocsByTimeRange(w http.ResponseWriter, r *h
 	w.Header().Set("Content-Type", contentTypeHeader)
 
 	var request struct {
-		Index     string    `json:"index"`
 		StartTime time.Time `json:"start_time"`
 		EndTime   time.Time `json:"end_time"`
 	}
 	// Decode request body
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		log.Printf("getDocByTimeRange: Invalid input to search by time: %v", err)
-		http.Error(w, `{"error":{"code":"INVALID_REQUEST","message":"Invalid input"}}`, http.StatusBadRequest)
+		handleInvalidRequest(w, err, "getDocByTimeRange")
 		return
 	}
 
-	docs, err := h.elasticsearchService.SearchByTimeRange(request.Index, request.StartTime, request.EndTime)
+	limit, cursor, err := pageParams(r)
 	if err != nil {
-		log.Printf("getDocByTimeRange: Error retrieving documents from index %s between %s and %s: %v", request.Index, request.StartTime, request.EndTime, err)
-		http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to retrieve documents"}}`, http.StatusInternalServerError)
+		writeError(w, err, "getDocByTimeRange")
 		return
 	}
 
-	if len(docs) == 0 {
-		log.Printf("getDocByTimeRange: No documents found in index %s between %s and %s", request.Index, request.StartTime, request.EndTime)
-		http.Error(w, `{"error":{"code":"NOT_FOUND","message":"No documents found"}}`, http.StatusNotFound)
+	page, err := h.elasticsearchService.SearchByTimeRange(service.TenantFromContext(r.Context()), config.ElasticsearchSMSAlias, request.StartTime, request.EndTime, limit, cursor)
+	if err != nil {
+		writeError(w, err, "getDocByTimeRange")
+		return
+	}
+
+	if page.Total == 0 {
+		writeError(w, fmt.Errorf("%w: no documents between %s and %s", service.ErrNotFound, request.StartTime.Format(time.RFC3339), request.EndTime.Format(time.RFC3339)), "getDocByTimeRange")
 		return
 	}
 
-	response := searchByTimeRangeResponse{Data: docs}
+	response := searchPageResponse{Data: page.Hits, Total: page.Total, NextCursor: page.NextCursor}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		handleEncodingError(w, err, "getDocByTimeRange")
 	}
 }
       
+// SearchSMS combines the search filters of the query string: q (message
+// text), phone, phone_contains (3 or more digits of the number), status
+// (comma separated), sender, tenant (operator only), created_from, created_to,
+// updated_from and updated_to (RFC 3339), sort, highlight, limit and cursor.
+func (h *ElasticSearchController) SearchSMS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeHeader)
+	query := r.URL.Query()
+
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		writeError(w, err, "SearchSMS")
+		return
+	}
+	search := service.SMSSearch{
+		Text:          query.Get("q"),
+		PhoneNumber:   query.Get("phone"),
+		PhoneContains: query.Get("phone_contains"),
+		SenderID:      query.Get("sender"),
+		Sort:          query.Get("sort"),
+		Limit:         limit,
+		Cursor:        cursor,
+		Highlight:     query.Get("highlight") == "true",
+	}
+	if statuses := query.Get("status"); statuses != "" {
+		search.Statuses = strings.Split(statuses, ",")
+	}
+	if search.TenantID, err = queryTenant(r); err != nil {
+		writeError(w, err, "SearchSMS")
+		return
+	}
+	for _, bound := range []struct {
+		param string
+		value *time.Time
+	}{
+		{"created_from", &search.CreatedFrom},
+		{"created_to", &search.CreatedTo},
+		{"updated_from", &search.UpdatedFrom},
+		{"updated_to", &search.UpdatedTo},
+	} {
+		if *bound.value, err = queryTime(r, bound.param); err != nil {
+			writeError(w, err, "SearchSMS")
+			return
+		}
+	}
+
+	result, err := h.elasticsearchService.SearchSMS(search)
+	if err != nil {
+		writeError(w, err, "SearchSMS")
+		return
+	}
+
+	response := searchSMSResponse{Data: result.Hits, Total: result.Total, NextCursor: result.NextCursor}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		handleEncodingError(w, err, "SearchSMS")
+	}
+}
+
+// GetSMSAnalytics reports delivery analytics of the SMS created between the
+// from and to query parameters (RFC 3339): counts per status over time in
+// interval buckets, failure reasons, the top recipients and latency
+// percentiles. tenant selects another tenant for operator clients.
+func (h *ElasticSearchController) GetSMSAnalytics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeHeader)
+	query := r.URL.Query()
+
+	request := service.SMSAnalyticsRequest{Interval: query.Get("interval"), TopRecipients: defaultTopRecipients}
+	var err error
+	if request.TenantID, err = queryTenant(r); err != nil {
+		writeError(w, err, "GetSMSAnalytics")
+		return
+	}
+	if request.From, err = queryTime(r, "from"); err != nil {
+		writeError(w, err, "GetSMSAnalytics")
+		return
+	}
+	if request.To, err = queryTime(r, "to"); err != nil {
+		writeError(w, err, "GetSMSAnalytics")
+		return
+	}
+	if raw := query.Get("top"); raw != "" {
+		top, err := strconv.Atoi(raw)
+		if err != nil || top <= 0 || top > maxTopRecipients {
+			writeError(w, fmt.Errorf("%w: top must be between 1 and %d", service.ErrValidation, maxTopRecipients), "GetSMSAnalytics")
+			return
+		}
+		request.TopRecipients = top
+	}
+
+	analytics, err := h.elasticsearchService.SMSAnalytics(request)
+	if err != nil {
+		writeError(w, err, "GetSMSAnalytics")
+		return
+	}
+
+	response := smsAnalyticsResponse{Data: analytics}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		handleEncodingError(w, err, "GetSMSAnalytics")
+	}
+}
+
+// StartBackfill starts indexing the SMS of MySQL into the target of the
+// request body; an empty body backfills the period indices. Operators only:
+// a backfill covers every tenant, and so do its counts.
+func (h *ElasticSearchController) StartBackfill(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeHeader)
+
+	var request service.BackfillRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		handleInvalidRequest(w, err, "StartBackfill")
+		return
+	}
+
+	job, err := h.backfillService.StartBackfill(request)
+	if err != nil {
+		writeError(w, err, "StartBackfill")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(backfillJobResponse{Data: job}); err != nil {
+		handleEncodingError(w, err, "StartBackfill")
+	}
+}
+
+// GetBackfillJob handles requests for the progress of a backfill job.
+// Operators only.
+func (h *ElasticSearchController) GetBackfillJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeHeader)
+
+	job, err := h.backfillService.GetBackfillJob(mux.Vars(r)["jobID"])
+	if err != nil {
+		writeError(w, err, "GetBackfillJob")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(backfillJobResponse{Data: job}); err != nil {
+		handleEncodingError(w, err, "GetBackfillJob")
+	}
+}
+
 // Helper functions
-func handleInternalError(w http.ResponseWriter, err error, method string) {
-	log.Printf("%s: Error: %v", method, err)
-	http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to retrieve document"}}`, http.StatusInternalServerError)
+
+// queryTenant returns the tenant a search runs for: the client's own, or the
+// one named by the tenant query parameter for operator clients.
+func queryTenant(r *http.Request) (string, error) {
+	tenantID := service.TenantFromContext(r.Context())
+	requested := r.URL.Query().Get("tenant")
+	if requested == "" || requested == tenantID {
+		return tenantID, nil
+	}
+	if err := checkTenant(r, requested); err != nil {
+		return "", err
+	}
+	return requested, nil
 }
-   
-func handleNotFound(w http.ResponseWriter, id string, index string, method string) {
-	log.Printf("%s: Document with ID %s not found in index %s", method, id, index)
-	http.Error(w, `{"error":{"code":"NOT_FOUND","message":"Document not found"}}`, http.StatusNotFound)
+
+// queryTime parses the RFC 3339 time of a query parameter. A missing
+// parameter is the zero time.
+func queryTime(r *http.Request, param string) (time.Time, error) {
+	raw := r.URL.Query().Get(param)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be an RFC 3339 time", service.ErrValidation, param)
+	}
+	return t, nil
 }
-  
-func handleEncodingError(w http.ResponseWriter, err error, method string) {
-	log.Printf("%s: Error encoding response: %v", method, err)
-	http.Error(w, `{"error":{"code":"INTERNAL_ERROR","message":"Failed to encode response"}}`, http.StatusInternalServerError)
+
+// pageParams reads the page size and the cursor of the next page from the
+// query string. A missing cursor requests the first page.
+func pageParams(r *http.Request) (int, string, error) {
+	query := r.URL.Query()
+	limit := defaultSearchPageSize
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxSearchPageSize {
+			return 0, "", fmt.Errorf("%w: limit must be between 1 and %d", service.ErrValidation, maxSearchPageSize)
+		}
+		limit = parsed
+	}
+	return limit, query.Get("cursor"), nil
 }
-  
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	service "notifications/internal/pkg/service"
+)
+
+// Error codes of the error envelope
+const (
+	CodeInvalidRequest    = "INVALID_REQUEST"
+	CodeUnauthorized      = "UNAUTHORIZED"
+	CodeNotFound          = "NOT_FOUND"
+	CodeAlreadyExists     = "ALREADY_EXISTS"
+	CodeForbidden         = "FORBIDDEN"
+	CodeNumberBlacklisted = "NUMBER_BLACKLISTED"
+	CodeQuotaExceeded     = "QUOTA_EXCEEDED"
+	CodeUnavailable       = "SERVICE_UNAVAILABLE"
+	CodeInternalError     = "INTERNAL_ERROR"
+)
+
+// Messages of server errors, whose details only go to the log
+const (
+	InternalError      = "Internal error occurred"
+	unavailableMessage = "Service temporarily unavailable, please retry"
+)
+
+// errorStatus maps a service error to its HTTP status and envelope code.
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, service.ErrValidation):
+		return http.StatusBadRequest, CodeInvalidRequest
+	case errors.Is(err, service.ErrUnauthorized):
+		return http.StatusUnauthorized, CodeUnauthorized
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden, CodeForbidden
+	case errors.Is(err, service.ErrAlreadyExists):
+		return http.StatusConflict, CodeAlreadyExists
+	case errors.Is(err, service.ErrBlacklisted):
+		return http.StatusUnprocessableEntity, CodeNumberBlacklisted
+	case errors.Is(err, service.ErrOverQuota):
+		return http.StatusTooManyRequests, CodeQuotaExceeded
+	case errors.Is(err, service.ErrUnavailable):
+		return http.StatusServiceUnavailable, CodeUnavailable
+	default:
+		return http.StatusInternalServerError, CodeInternalError
+	}
+}
+
+// writeError writes the error envelope for a service error. Client errors
+// carry the error text; server errors get a generic message and the details
+// only go to the log.
+func writeError(w http.ResponseWriter, err error, method string) {
+	log.Printf("%s: %v", method, err)
+	status, code := errorStatus(err)
+
+	message := err.Error()
+	switch status {
+	case http.StatusServiceUnavailable:
+		message = unavailableMessage
+	case http.StatusInternalServerError:
+		message = InternalError
+	}
+	http.Error(w, encodeJSON(ErrorResponse_Message{Error: ErrorDetail{Code: code, Message: message}}), status)
+}
+
+// handleInvalidRequest writes the error envelope for a request the controller
+// rejected before reaching the service, such as an unparsable body.
+func handleInvalidRequest(w http.ResponseWriter, err error, method string) {
+	writeError(w, fmt.Errorf("%w: %v", service.ErrValidation, err), method)
+}
+
+// handleEncodingError writes the error envelope for a response that could not
+// be encoded.
+func handleEncodingError(w http.ResponseWriter, err error, method string) {
+	writeError(w, fmt.Errorf("error encoding response: %w", err), method)
+}
@@ -3,7 +3,6 @@ package controllers
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"notifications/internal/models"
 	service "notifications/internal/pkg/service"
@@ -13,18 +12,9 @@ import (
 	"golang.org/x/exp/rand"
 )
 
-// Define constants for error messages and status codes
+// Define constants for the content type
 const (
-	ContentTypeJSON               = "application/json"
-	ErrorInvalidInput             = `{"error":{"code":"INVALID_REQUEST","message":"Invalid input"}}`
-	ErrorInternalServer           = `{"error":{"code":"INTERNAL_ERROR","message":"Internal server error"}}`
-	ErrorFailedToInsertIntoDB     = `{"error":{"code":"INTERNAL_ERROR","message":"Failed to insert into database"}}`
-	ErrorFailedToProcessMessages  = `{"error":{"code":"INTERNAL_ERROR","message":"Error processing messages"}}`
-	ErrorFailedToRetrieveSMSList  = `{"error":{"code":"INTERNAL_ERROR","message":"Error retrieving SMS list"}}`
-	ErrorFailedToCheckIDExists    = `{"error":{"code":"INTERNAL_ERROR","message":"Failed to check ID existence"}}`
-	ErrorIDNotFound               = `{"error":{"code":"INVALID_REQUEST","message":"request_ID not found"}}`
-	ErrorFailedToRetrieveSMS      = `{"error":{"code":"INTERNAL_ERROR","message":"Failed to retrieve SMS details"}}`
-	ErrorFailedToEncodeResponse   = `{"error":{"code":"INTERNAL_SERVER_ERROR","message":"Unable to encode response"}}`
+	ContentTypeJSON = "application/json"
 )
 
 // Response structs for different methods
@@ -47,6 +37,10 @@ type GetMessageByIDResponse struct {
 	Data *models.SMS `json:"data"`
 }
 
+type ReplayJobResponse struct {
+	Data service.ReplayJob `json:"data"`
+}
+
 type ErrorResponse_Message struct {
 	Error ErrorDetail `json:"error"`
 }
@@ -59,12 +53,13 @@ type ErrorDetail struct {
 // MessageController handles requests related to messages
 type MessageController struct {
 	MessageService *service.MessageService
+	TenantService  *service.TenantService
 }
 
 // NewMessageController creates a new MessageController
 func GetMessageController() *MessageController {
 	message:= service.GetMessageService()
-	return &MessageController{MessageService: message}
+	return &MessageController{MessageService: message, TenantService: service.GetTenantService()}
 }
 // NotifyServer handles requests to notify the server
 func (h *MessageController) NotifyServer(w http.ResponseWriter, r *http.Request) {
@@ -72,15 +67,58 @@ func (h *MessageController) NotifyServer(w http.ResponseWriter, r *http.Request)
     
 	var sms models.SMS
 	if err := json.NewDecoder(r.Body).Decode(&sms); err != nil {
-		h.sendErrorResponseMessage(w, ErrorInvalidInput, http.StatusBadRequest)
+		handleInvalidRequest(w, err, "NotifyServer")
+		return
+	}
+	// The SMS is stored, indexed and checked against the blacklist in the
+	// normalized form
+	normalized, err := service.NormalizePhoneNumber(sms.PhoneNumber)
+	if err != nil {
+		writeError(w, err, "NotifyServer")
 		return
 	}
+	sms.PhoneNumber = normalized
     
 	h.setSMSFields(&sms)
+	if client, ok := service.ClientFromContext(r.Context()); ok {
+		sms.ClientID = client.ClientID
+	}
+	sms.TenantID = service.TenantFromContext(r.Context())
+
+	tenant, err := h.TenantService.GetTenant(sms.TenantID)
+	if err != nil {
+		writeError(w, err, "NotifyServer")
+		return
+	}
+	if err := service.ApplySender(tenant, &sms); err != nil {
+		writeError(w, err, "NotifyServer")
+		return
+	}
+	// Tenants that want an audit row for blocked SMS leave this off; the SMS is
+	// then stored and marked Failed when it is processed.
+	if tenant.RejectBlacklisted {
+		blacklisted, err := h.MessageService.IsBlacklisted(sms.TenantID, sms.PhoneNumber)
+		if err != nil {
+			writeError(w, err, "NotifyServer")
+			return
+		}
+		if blacklisted {
+			writeError(w, fmt.Errorf("%w: phone number %s is blacklisted", service.ErrBlacklisted, sms.PhoneNumber), "NotifyServer")
+			return
+		}
+	}
+	exceeded, err := h.TenantService.QuotaExceeded(tenant)
+	if err != nil {
+		writeError(w, err, "NotifyServer")
+		return
+	}
+	if exceeded {
+		writeError(w, fmt.Errorf("%w: %s", service.ErrOverQuota, service.ErrQuotaExceeded), "NotifyServer")
+		return
+	}
     
 	if err := h.MessageService.CreateMessage(&sms); err != nil {
-		log.Printf("NotifyServer: %v", err)
-		h.sendErrorResponseMessage(w, ErrorFailedToInsertIntoDB, http.StatusInternalServerError)
+		writeError(w, err, "NotifyServer")
 		return
 	}
     
@@ -99,8 +137,7 @@ func (h *MessageController) SendMessageToUsers(w http.ResponseWriter, r *http.Re
     
 	results, err := h.MessageService.ProcessMessages()
 	if err != nil {
-		log.Printf("SendMessageToUsers: %v", err)
-		h.sendErrorResponseMessage(w, ErrorFailedToProcessMessages, http.StatusInternalServerError)
+		writeError(w, err, "SendMessageToUsers")
 		return
 	}
     
@@ -114,10 +151,9 @@ func (h *MessageController) SendMessageToUsers(w http.ResponseWriter, r *http.Re
 func (h *MessageController) GetAllMessages(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", ContentTypeJSON)
     
-	smsList, err := h.MessageService.GetAllMessages()
+	smsList, err := h.MessageService.GetAllMessages(service.TenantFromContext(r.Context()))
 	if err != nil {
-		log.Printf("GetAllMessages: %v", err)
-		h.sendErrorResponseMessage(w, ErrorFailedToRetrieveSMSList, http.StatusInternalServerError)
+		writeError(w, err, "GetAllMessages")
 		return
 	}
     
@@ -133,25 +169,12 @@ func (h *MessageController) GetMessageByID(w http.ResponseWriter, r *http.Reques
 
 	vars := mux.Vars(r)
 	msgID := vars["ID"]
-
-	// Check if the ID exists
-	exists, err := h.MessageService.CheckIDExists(msgID)
-	if err != nil {
-		log.Printf("GetMessageByID: %v", err)
-		h.sendErrorResponseMessage(w, ErrorFailedToCheckIDExists, http.StatusInternalServerError)
-		return
-	}
-
-	if !exists {
-		h.sendErrorResponseMessage(w, ErrorIDNotFound, http.StatusNotFound)
-		return
-	}
+	tenantID := service.TenantFromContext(r.Context())
 
 	// Retrieve the SMS message by ID
-	sms, err := h.MessageService.GetMessageByID(msgID)
+	sms, err := h.MessageService.GetMessageByID(tenantID, msgID)
 	if err != nil {
-		log.Printf("GetMessageByID: %v", err)
-		h.sendErrorResponseMessage(w, ErrorFailedToRetrieveSMS, http.StatusInternalServerError)
+		writeError(w, err, "GetMessageByID")
 		return
 	}
 
@@ -165,6 +188,39 @@ func (h *MessageController) GetMessageByID(w http.ResponseWriter, r *http.Reques
 	h.sendSuccessResponse(w, response)
 }
 
+// ReplayMessages re-queues every message matching the filter in the request body
+func (h *MessageController) ReplayMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+
+	var filter service.ReplayFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		handleInvalidRequest(w, err, "ReplayMessages")
+		return
+	}
+	filter.TenantID = service.TenantFromContext(r.Context())
+
+	job, err := h.MessageService.StartReplay(filter)
+	if err != nil {
+		writeError(w, err, "ReplayMessages")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	h.sendSuccessResponse(w, ReplayJobResponse{Data: job})
+}
+
+// GetReplayJob handles requests for the progress of a replay job
+func (h *MessageController) GetReplayJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+
+	jobID := mux.Vars(r)["jobID"]
+	job, err := h.MessageService.GetReplayJob(service.TenantFromContext(r.Context()), jobID)
+	if err != nil {
+		writeError(w, err, "GetReplayJob")
+		return
+	}
+	h.sendSuccessResponse(w, ReplayJobResponse{Data: job})
+}
 
 // Helper function to set SMS fields
 func (h *MessageController) setSMSFields(sms *models.SMS) {
@@ -177,12 +233,6 @@ func (h *MessageController) setSMSFields(sms *models.SMS) {
 // Helper function to send success responses
 func (h *MessageController) sendSuccessResponse(w http.ResponseWriter, data interface{}) {
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("sendSuccessResponse: %v", err)
-		h.sendErrorResponseMessage(w, ErrorFailedToEncodeResponse, http.StatusInternalServerError)
+		handleEncodingError(w, err, "sendSuccessResponse")
 	}
 }
-
-// Helper function to send error responses
-func (h *MessageController) sendErrorResponseMessage(w http.ResponseWriter, errorMessage string, statusCode int) {
-	http.Error(w, errorMessage, statusCode)
-}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"notifications/internal/models"
+	service "notifications/internal/pkg/service"
+
+	"github.com/gorilla/mux"
+)
+
+type TenantResponse struct {
+	Data *models.Tenant `json:"data"`
+}
+
+// TenantController manages per-tenant settings
+type TenantController struct {
+	tenantService *service.TenantService
+}
+
+func GetTenantController() *TenantController {
+	return &TenantController{tenantService: service.GetTenantService()}
+}
+
+// GetTenant returns a tenant's settings
+func (h *TenantController) GetTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+
+	tenantID := mux.Vars(r)["tenantID"]
+	if err := checkTenant(r, tenantID); err != nil {
+		writeError(w, err, "GetTenant")
+		return
+	}
+	tenant, err := h.tenantService.GetTenant(tenantID)
+	if err != nil {
+		writeError(w, err, "GetTenant")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(TenantResponse{Data: tenant}); err != nil {
+		log.Printf("GetTenant: %v", err)
+	}
+}
+
+// SaveTenant creates or replaces a tenant's settings
+func (h *TenantController) SaveTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+
+	tenantID := mux.Vars(r)["tenantID"]
+	if err := checkTenant(r, tenantID); err != nil {
+		writeError(w, err, "SaveTenant")
+		return
+	}
+
+	var request struct {
+		Name              string `json:"name"`
+		SenderIDs         string `json:"sender_ids"`
+		DailyQuota        int    `json:"daily_quota"`
+		WebhookURL        string `json:"webhook_url"`
+		RejectBlacklisted bool   `json:"reject_blacklisted"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		handleInvalidRequest(w, err, "SaveTenant")
+		return
+	}
+
+	tenant := &models.Tenant{
+		ID:                tenantID,
+		Name:              request.Name,
+		SenderIDs:         request.SenderIDs,
+		DailyQuota:        request.DailyQuota,
+		WebhookURL:        request.WebhookURL,
+		RejectBlacklisted: request.RejectBlacklisted,
+	}
+	if err := h.tenantService.SaveTenant(tenant); err != nil {
+		writeError(w, err, "SaveTenant")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(TenantResponse{Data: tenant}); err != nil {
+		log.Printf("SaveTenant: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Aggregate runs request, a search body that only asks for aggregations, on
+// index and decodes the response into result. No hits are returned.
+func (r *ElasticsearchRepo) Aggregate(index string, request map[string]interface{}, result interface{}) error {
+	request["size"] = 0
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("error marshaling aggregation request: %w", err)
+	}
+
+	res, err := r.client.Search(
+		r.client.Search.WithContext(context.Background()),
+		r.client.Search.WithIndex(index),
+		r.client.Search.WithBody(bytes.NewReader(body)),
+		r.client.Search.WithIgnoreUnavailable(true),
+		r.client.Search.WithAllowNoIndices(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate documents in index %s: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("Aggregate: Elasticsearch error: %s", res.String())
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode aggregations: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	config "notifications/configurations"
+	"notifications/internal/models"
+)
+
+// SMSDocument is the source of an SMS in the SMS indices. Version is the
+// update time in milliseconds, used as external version so that a retried
+// document never replaces a newer one. Index overrides the write alias; full
+// documents always name the index of the period they were created in.
+// Partial documents only carry changed fields and update the indexed document
+// instead of replacing it.
+type SMSDocument struct {
+	ID      string
+	Index   string
+	Version int64
+	Partial bool
+	Source  json.RawMessage
+}
+
+// NewSMSDocument returns the document of an SMS that was created at createdAt
+// and last changed at updatedAt. It goes to the index of the createdAt period
+// rather than the write alias, so an SMS changed after the write alias rolled
+// over stays in one index.
+func NewSMSDocument(sms models.SMS, createdAt time.Time, updatedAt time.Time) (SMSDocument, error) {
+	source, err := json.Marshal(map[string]interface{}{
+		"id":               sms.ID,
+		"tenant_id":        sms.TenantID,
+		"sender_id":        sms.SenderID,
+		"phone_number":     sms.PhoneNumber,
+		"message":          sms.Message,
+		"status":           sms.Status,
+		"failure_code":     sms.FailureCode,
+		"failure_comments": sms.FailureComments,
+		"created_at":       createdAt,
+		"updated_at":       updatedAt,
+	})
+	if err != nil {
+		return SMSDocument{}, fmt.Errorf("error marshaling document to JSON: %w", err)
+	}
+	return SMSDocument{ID: sms.ID, Index: SMSIndexName(createdAt), Version: updatedAt.UnixMilli(), Source: source}, nil
+}
+
+// NewSMSStatusUpdate returns the partial document that changes the status of
+// an indexed SMS, changed at updatedAt.
+func NewSMSStatusUpdate(id, status, failureComments string, updatedAt time.Time) (SMSDocument, error) {
+	source, err := json.Marshal(map[string]interface{}{
+		"status":           status,
+		"failure_comments": failureComments,
+		"updated_at":       updatedAt,
+	})
+	if err != nil {
+		return SMSDocument{}, fmt.Errorf("error marshaling status update to JSON: %w", err)
+	}
+	return SMSDocument{ID: id, Version: updatedAt.UnixMilli(), Partial: true, Source: source}, nil
+}
+
+// LocateSMS returns the index each of the SMS documents is stored in, looked
+// up through the read alias. Documents that aren't searchable yet are left
+// out.
+func (e *ElasticsearchRepo) LocateSMS(ids []string) (map[string]string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":   map[string]interface{}{"ids": map[string]interface{}{"values": ids}},
+		"_source": false,
+		"size":    len(ids),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling search request: %w", err)
+	}
+
+	res, err := e.client.Search(
+		e.client.Search.WithContext(context.Background()),
+		e.client.Search.WithIndex(config.ElasticsearchSMSAlias),
+		e.client.Search.WithBody(bytes.NewReader(body)),
+		e.client.Search.WithIgnoreUnavailable(true),
+		e.client.Search.WithAllowNoIndices(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate %d documents: %w", len(ids), err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("LocateSMS: Elasticsearch error: %s", res.String())
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				Index string `json:"_index"`
+				ID    string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+	indices := make(map[string]string, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		indices[hit.ID] = hit.Index
+	}
+	return indices, nil
+}
+
+// BulkIndexSMS indexes docs through the write alias in one bulk request and
+// returns the documents worth retrying: those rejected for load or a server
+// error, and partial documents whose SMS isn't indexed yet. Documents older
+// than the indexed version are skipped, and documents Elasticsearch refuses
+// outright are logged and dropped, as they would fail again. Partial
+// documents update the document in their Index, or in the write alias if it
+// is empty. The index isn't refreshed; documents become searchable with the
+// next periodic refresh.
+func (e *ElasticsearchRepo) BulkIndexSMS(docs []SMSDocument) ([]SMSDocument, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, doc := range docs {
+		meta := map[string]interface{}{"_id": doc.ID}
+		if doc.Index != "" {
+			meta["_index"] = doc.Index
+		}
+		action := map[string]interface{}{"index": meta}
+		source := doc.Source
+		if doc.Partial {
+			// Updates can't use external versions
+			meta["retry_on_conflict"] = 3
+			action = map[string]interface{}{"update": meta}
+			source, _ = json.Marshal(map[string]json.RawMessage{"doc": doc.Source})
+		} else {
+			meta["version"] = doc.Version
+			meta["version_type"] = "external_gte"
+		}
+		if err := encoder.Encode(action); err != nil {
+			return nil, fmt.Errorf("error marshaling bulk action: %w", err)
+		}
+		body.Write(source)
+		body.WriteByte('\n')
+	}
+
+	res, err := e.client.Bulk(
+		bytes.NewReader(body.Bytes()),
+		e.client.Bulk.WithContext(context.Background()),
+		e.client.Bulk.WithIndex(config.ElasticsearchSMSWriteAlias),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bulk index %d documents: %w", len(docs), err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("BulkIndexSMS: Elasticsearch error: %s", res.String())
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var response struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	if !response.Errors {
+		return nil, nil
+	}
+
+	// Items are returned in request order
+	var retry []SMSDocument
+	for i, item := range response.Items {
+		if i >= len(docs) {
+			break
+		}
+		result := item["index"]
+		if docs[i].Partial {
+			result = item["update"]
+		}
+		if result.Status < http.StatusBadRequest || result.Status == http.StatusConflict {
+			continue
+		}
+		missing := docs[i].Partial && result.Status == http.StatusNotFound
+		if missing || result.Status == http.StatusTooManyRequests || result.Status >= http.StatusInternalServerError {
+			retry = append(retry, docs[i])
+			continue
+		}
+		log.Printf("BulkIndexSMS: Dropping document %s rejected with status %d: %s", result.ID, result.Status, result.Error)
+	}
+	return retry, nil
+}
+
+// Refresh makes everything indexed in index so far searchable.
+func (e *ElasticsearchRepo) Refresh(index string) error {
+	res, err := e.client.Indices.Refresh(
+		e.client.Indices.Refresh.WithIndex(index),
+		e.client.Indices.Refresh.WithIgnoreUnavailable(true),
+		e.client.Indices.Refresh.WithAllowNoIndices(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to refresh index %s: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("Refresh: Elasticsearch error: %s", res.String())
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	return nil
+}
@@ -0,0 +1,684 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	config "notifications/configurations"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// SMSMappingVersion is the version of smsMapping. Bump it whenever the mapping
+// changes; the next start reindexes every SMS into sms_v<version>-* indices.
+const SMSMappingVersion = 2
+
+// legacySMSIndex is the index used before the alias, migrated on first start
+const legacySMSIndex = "sms_index"
+
+// Index periods
+const (
+	IndexPeriodMonthly = "monthly"
+	IndexPeriodDaily   = "daily"
+)
+
+// Retention actions for indices older than the retention period
+const (
+	RetentionDelete = "delete"
+	RetentionClose  = "close"
+)
+
+// smsMapping is the mapping of the SMS indices, applied through the index
+// template of the mapping version. Fields not listed here are kept in the
+// source but not indexed.
+//
+// The message is analysed twice: by the standard analyzer, and by
+// sms_folded, which also folds case, accents, Unicode digits and the variant
+// spellings of Indic scripts, so Hindi and other Indic messages match however
+// they were typed. The standard tokenizer splits words by the Unicode rules,
+// which covers Indic scripts as well. phone_number.ngram holds every run of 3
+// to 16 digits of the number, for searching by part of it. Both sides drop
+// everything but digits first, so a part spanning the country code matches
+// however the number and the search were written.
+const smsMapping = `{
+	"settings": {
+		"index.max_ngram_diff": 13,
+		"analysis": {
+			"char_filter": {
+				"phone_digits": {
+					"type": "pattern_replace",
+					"pattern": "[^0-9]",
+					"replacement": ""
+				}
+			},
+			"tokenizer": {
+				"phone_ngram": {
+					"type": "ngram",
+					"min_gram": 3,
+					"max_gram": 16,
+					"token_chars": ["digit"]
+				}
+			},
+			"analyzer": {
+				"sms_folded": {
+					"type": "custom",
+					"tokenizer": "standard",
+					"filter": ["lowercase", "decimal_digit", "asciifolding", "indic_normalization", "hindi_normalization"]
+				},
+				"phone_ngram": {
+					"type": "custom",
+					"char_filter": ["phone_digits"],
+					"tokenizer": "phone_ngram"
+				},
+				"phone_search": {
+					"type": "custom",
+					"char_filter": ["phone_digits"],
+					"tokenizer": "keyword"
+				}
+			}
+		}
+	},
+	"mappings": {
+		"dynamic": false,
+		"properties": {
+			"id": {
+				"type": "keyword"
+			},
+			"tenant_id": {
+				"type": "keyword"
+			},
+			"sender_id": {
+				"type": "keyword"
+			},
+			"phone_number": {
+				"type": "keyword",
+				"fields": {
+					"ngram": {
+						"type": "text",
+						"analyzer": "phone_ngram",
+						"search_analyzer": "phone_search"
+					}
+				}
+			},
+			"status": {
+				"type": "keyword"
+			},
+			"failure_code": {
+				"type": "keyword"
+			},
+			"failure_comments": {
+				"type": "text",
+				"fields": {
+					"keyword": {
+						"type": "keyword",
+						"ignore_above": 256
+					}
+				}
+			},
+			"message": {
+				"type": "text",
+				"analyzer": "standard",
+				"fields": {
+					"folded": {
+						"type": "text",
+						"analyzer": "sms_folded"
+					},
+					"keyword": {
+						"type": "keyword",
+						"ignore_above": 1024
+					}
+				}
+			},
+			"created_at": {
+				"type": "date",
+				"format": "strict_date_time"
+			},
+			"updated_at": {
+				"type": "date",
+				"format": "strict_date_time"
+			}
+		}
+	}
+}`
+
+var (
+	errIndexExists  = errors.New("index already exists")
+	errAliasMissing = errors.New("alias or index missing")
+)
+
+// smsIndexPrefix returns the prefix shared by the indices of a mapping version.
+func smsIndexPrefix(version int) string {
+	return fmt.Sprintf("sms_v%d-", version)
+}
+
+// smsPeriodLayout returns the time layout of the period part of index names
+// and how many characters of a created_at timestamp it covers.
+func smsPeriodLayout() (string, int) {
+	if config.ElasticsearchIndexPeriod == IndexPeriodDaily {
+		return "2006.01.02", 10
+	}
+	return "2006.01", 7
+}
+
+// nextSMSPeriod returns the start of the period after the one containing t.
+func nextSMSPeriod(t time.Time) time.Time {
+	if config.ElasticsearchIndexPeriod == IndexPeriodDaily {
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+}
+
+// SMSIndexName returns the index SMS created at t are stored in, e.g.
+// sms_v1-2026.10.
+func SMSIndexName(t time.Time) string {
+	layout, _ := smsPeriodLayout()
+	return smsIndexPrefix(SMSMappingVersion) + t.Format(layout)
+}
+
+// smsIndexPeriodStart parses the start of the period an index of the current
+// mapping version covers.
+func smsIndexPeriodStart(index string) (time.Time, bool) {
+	period, ok := strings.CutPrefix(index, smsIndexPrefix(SMSMappingVersion))
+	if !ok {
+		return time.Time{}, false
+	}
+	layout, _ := smsPeriodLayout()
+	start, err := time.Parse(layout, period)
+	return start, err == nil
+}
+
+// SMSIndexPattern returns the indices holding SMS created between start and
+// end as a comma separated list, so searches skip the other periods. Open
+// ended or very long ranges fall back to the read alias.
+func SMSIndexPattern(start, end time.Time) string {
+	const maxIndices = 64
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return config.ElasticsearchSMSAlias
+	}
+
+	var indices []string
+	for t := start; !t.After(end); t = nextSMSPeriod(t) {
+		if len(indices) == maxIndices {
+			return config.ElasticsearchSMSAlias
+		}
+		indices = append(indices, SMSIndexName(t))
+	}
+	return strings.Join(indices, ",")
+}
+
+// EnsureSMSIndex prepares the indices of the current mapping version: it
+// installs their index template, through which new indices join the read
+// alias, and rolls the aliases to the index of the current period. SMS in the indices of an older version or the legacy single
+// index are migrated in the background, by one instance at a time; until the
+// migration switches the aliases, the old indices keep serving reads and
+// writes. Nothing is migrated when the read alias only holds current indices,
+// and existing indices are never deleted.
+func (r *ElasticsearchRepo) EnsureSMSIndex() error {
+	prefix := smsIndexPrefix(SMSMappingVersion)
+	current, err := r.AliasIndices(config.ElasticsearchSMSAlias)
+	if err != nil {
+		return err
+	}
+	var sources []string
+	for _, index := range current {
+		if !strings.HasPrefix(index, prefix) {
+			sources = append(sources, index)
+		}
+	}
+	if len(current) == 0 {
+		legacy, err := r.IndexExists(legacySMSIndex)
+		if err != nil {
+			return err
+		}
+		if legacy {
+			sources = []string{legacySMSIndex}
+		}
+	}
+
+	if err := r.putSMSTemplate(len(sources) == 0); err != nil {
+		return err
+	}
+
+	writing, err := r.AliasIndices(config.ElasticsearchSMSWriteAlias)
+	if err != nil {
+		return err
+	}
+	// Without a write index, writes would create a stray index named after
+	// the write alias
+	if len(sources) == 0 || len(writing) == 0 {
+		if err := r.rollSMSIndex(time.Now().UTC().Add(5*time.Hour + 30*time.Minute)); err != nil {
+			return err
+		}
+	}
+	if len(sources) > 0 {
+		go r.migrateLocked(sources)
+	}
+	return nil
+}
+
+// migrateLocked migrates the source indices if no other instance is already
+// doing it.
+func (r *ElasticsearchRepo) migrateLocked(sources []string) {
+	acquired, err := r.acquireMigrationLock()
+	if err != nil {
+		log.Printf("migrateLocked: Failed to take the migration lock: %v", err)
+		return
+	}
+	if !acquired {
+		log.Printf("migrateLocked: Another instance is migrating %v", sources)
+		return
+	}
+	defer r.releaseMigrationLock()
+
+	if err := r.MigrateIndices(sources); err != nil {
+		log.Printf("migrateLocked: Failed to migrate %v: %v", sources, err)
+	}
+}
+
+// smsTemplate returns the index template of the current mapping version. With
+// readable set, indices join the read alias as they are created, so documents
+// written to the index of a new or an old period are searchable at once.
+// While a migration copies documents it is left unset, or the read alias
+// would serve every copied document twice until the switch.
+func smsTemplate(readable bool) (string, error) {
+	var template map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(smsMapping), &template); err != nil {
+		return "", fmt.Errorf("error parsing SMS mapping: %w", err)
+	}
+	if readable {
+		aliases, err := json.Marshal(map[string]interface{}{config.ElasticsearchSMSAlias: map[string]interface{}{}})
+		if err != nil {
+			return "", fmt.Errorf("error marshaling SMS template aliases: %w", err)
+		}
+		template["aliases"] = aliases
+	}
+	body, err := json.Marshal(template)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling SMS template: %w", err)
+	}
+	return string(body), nil
+}
+
+// putSMSTemplate installs the index template of the current mapping version.
+func (r *ElasticsearchRepo) putSMSTemplate(readable bool) error {
+	template, err := smsTemplate(readable)
+	if err != nil {
+		return err
+	}
+	prefix := smsIndexPrefix(SMSMappingVersion)
+	return r.PutIndexTemplate(strings.TrimSuffix(prefix, "-"), prefix+"*", template)
+}
+
+// MigrateIndices moves every SMS from the source indices into the period
+// indices of the current mapping version without downtime. Documents are
+// copied while the aliases still serve the sources. Both aliases are then
+// switched to the current version, and a second pass copies documents
+// written to the sources during the first one.
+func (r *ElasticsearchRepo) MigrateIndices(sources []string) error {
+	alias := config.ElasticsearchSMSAlias
+	prefix := smsIndexPrefix(SMSMappingVersion)
+
+	// Documents carry the same IST shifted timestamps as MySQL
+	now := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+	startedAt := now.Add(-time.Minute)
+	fallback := SMSIndexName(now)
+	if err := r.CreateIndex(fallback, `{}`); err != nil && !errors.Is(err, errIndexExists) {
+		return err
+	}
+
+	log.Printf("MigrateIndices: Reindexing %v into %s*", sources, prefix)
+	if err := r.reindexByPeriod(sources, fallback, nil); err != nil {
+		return err
+	}
+
+	actions := []map[string]interface{}{
+		{"add": map[string]string{"index": prefix + "*", "alias": alias}},
+	}
+	for _, source := range sources {
+		actions = append(actions, map[string]interface{}{"remove": map[string]string{"index": source, "alias": alias}})
+	}
+	if err := r.UpdateAliases(actions); errors.Is(err, errAliasMissing) {
+		// The legacy index was never behind the alias
+		err = r.UpdateAliases(actions[:1])
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// Indices created from now on, by the last pass or by writes, are read
+	// through the alias as soon as they exist
+	if err := r.putSMSTemplate(true); err != nil {
+		return err
+	}
+	// The sources must stop receiving writes before the last pass, or the
+	// writes made after it would be lost
+	if err := r.rollSMSIndex(now); err != nil {
+		return err
+	}
+	if err := r.reindexByPeriod(sources, fallback, &startedAt); err != nil {
+		return err
+	}
+	// An instance that started before the switch may have put the template
+	// without the alias back
+	if err := r.putSMSTemplate(true); err != nil {
+		return err
+	}
+	log.Printf("MigrateIndices: Alias %s now reads %s*; %v can be deleted once verified", alias, prefix, sources)
+	return nil
+}
+
+// reindexByPeriod copies documents from the source indices into the period
+// index of their created_at, or fallback when they have none.
+func (r *ElasticsearchRepo) reindexByPeriod(sources []string, fallback string, since *time.Time) error {
+	_, length := smsPeriodLayout()
+	script := map[string]interface{}{
+		"lang": "painless",
+		"source": "if (ctx._source.created_at == null) { ctx._index = params.fallback } " +
+			"else { ctx._index = params.prefix + ctx._source.created_at.substring(0, params.length).replace('-', '.') }",
+		"params": map[string]interface{}{
+			"prefix":   smsIndexPrefix(SMSMappingVersion),
+			"length":   length,
+			"fallback": fallback,
+		},
+	}
+	return r.Reindex(sources, fallback, since, script)
+}
+
+// RollSMSIndex makes the index of the period containing now the write index.
+// The index is created if needed, from the version's template, and joins the
+// read alias; older indices stay readable but no longer receive writes.
+// Nothing is rolled while a migration runs, since it rolls the aliases itself
+// once the older indices are copied.
+func (r *ElasticsearchRepo) RollSMSIndex(now time.Time) error {
+	migrating, err := r.migrationLocked()
+	if err != nil {
+		return err
+	}
+	if migrating {
+		log.Printf("RollSMSIndex: Migration to %s* in progress, not rolling", smsIndexPrefix(SMSMappingVersion))
+		return nil
+	}
+	return r.rollSMSIndex(now)
+}
+
+func (r *ElasticsearchRepo) rollSMSIndex(now time.Time) error {
+	index := SMSIndexName(now)
+	writeAlias := config.ElasticsearchSMSWriteAlias
+
+	writing, err := r.AliasIndices(writeAlias)
+	if err != nil {
+		return err
+	}
+	if len(writing) == 1 && writing[0] == index {
+		return nil
+	}
+
+	exists, err := r.IndexExists(index)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := r.CreateIndex(index, `{}`); err != nil && !errors.Is(err, errIndexExists) {
+			return err
+		}
+	}
+
+	actions := []map[string]interface{}{
+		{"add": map[string]interface{}{"index": index, "alias": config.ElasticsearchSMSAlias}},
+		{"add": map[string]interface{}{"index": index, "alias": writeAlias, "is_write_index": true}},
+	}
+	for _, old := range writing {
+		if old != index {
+			actions = append(actions, map[string]interface{}{"remove": map[string]string{"index": old, "alias": writeAlias}})
+		}
+	}
+	if err := r.UpdateAliases(actions); err != nil {
+		return err
+	}
+	log.Printf("RollSMSIndex: Writing SMS to %s", index)
+	return nil
+}
+
+// ApplyRetention deletes or closes, depending on the configured action, the
+// SMS indices of the current mapping version whose whole period ended more
+// than the retention ago. The write index is never touched.
+func (r *ElasticsearchRepo) ApplyRetention(now time.Time) error {
+	indices, err := r.ListIndices(smsIndexPrefix(SMSMappingVersion) + "*")
+	if err != nil {
+		return err
+	}
+	writeIndex := SMSIndexName(now)
+	cutoff := now.Add(-config.ElasticsearchRetention)
+
+	for index, status := range indices {
+		start, ok := smsIndexPeriodStart(index)
+		if !ok || index == writeIndex || !nextSMSPeriod(start).Before(cutoff) {
+			continue
+		}
+
+		switch {
+		case config.ElasticsearchRetentionAction == RetentionClose && status == "close":
+			continue
+		case config.ElasticsearchRetentionAction == RetentionClose:
+			err = r.CloseIndex(index)
+		default:
+			err = r.DeleteIndex(index)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("ApplyRetention: Applied %s to %s", config.ElasticsearchRetentionAction, index)
+	}
+	return nil
+}
+
+// CreateIndex creates an index with the given settings and mappings.
+func (r *ElasticsearchRepo) CreateIndex(index string, mapping string) error {
+	req := esapi.IndicesCreateRequest{
+		Index: index,
+		Body:  strings.NewReader(mapping),
+	}
+
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		log.Printf("CreateIndex: Failed to create index %s: %v", index, err)
+		return fmt.Errorf("failed to create index %s: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		// Another instance may have created it first
+		if strings.Contains(res.String(), "resource_already_exists_exception") {
+			return errIndexExists
+		}
+		log.Printf("CreateIndex: Elasticsearch error: %s", res.String())
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	log.Printf("CreateIndex: Index %s created successfully", index)
+	return nil
+}
+
+// PutIndexTemplate installs an index template applying the settings and
+// mappings in template to new indices matching pattern.
+func (r *ElasticsearchRepo) PutIndexTemplate(name string, pattern string, template string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"index_patterns": []string{pattern},
+		"template":       json.RawMessage(template),
+		"priority":       100,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling index template %s: %w", name, err)
+	}
+
+	res, err := r.client.Indices.PutIndexTemplate(name, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("PutIndexTemplate: Failed to put index template %s: %v", name, err)
+		return fmt.Errorf("failed to put index template %s: %w", name, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("PutIndexTemplate: Elasticsearch error: %s", res.String())
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	return nil
+}
+
+// AliasIndices returns the indices the alias points at, or none if the alias
+// doesn't exist.
+func (r *ElasticsearchRepo) AliasIndices(alias string) ([]string, error) {
+	res, err := r.client.Indices.GetAlias(r.client.Indices.GetAlias.WithName(alias))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alias %s: %w", alias, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.IsError() {
+		log.Printf("AliasIndices: Elasticsearch error: %s", res.String())
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var indices map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("failed to decode alias %s: %w", alias, err)
+	}
+	names := make([]string, 0, len(indices))
+	for name := range indices {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// UpdateAliases applies the alias add and remove actions atomically.
+func (r *ElasticsearchRepo) UpdateAliases(actions []map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return fmt.Errorf("error marshaling alias actions: %w", err)
+	}
+	res, err := r.client.Indices.UpdateAliases(bytes.NewReader(body))
+	if err != nil {
+		log.Printf("UpdateAliases: Failed to update aliases: %v", err)
+		return fmt.Errorf("failed to update aliases: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return errAliasMissing
+	}
+	if res.IsError() {
+		log.Printf("UpdateAliases: Elasticsearch error: %s", res.String())
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	return nil
+}
+
+// Reindex copies documents from the source indices into dest and waits for it
+// to finish. With since set, only documents updated at or after it are copied.
+// A non-nil script may rewrite each document or its target index. Documents
+// dest already holds at the same or a newer version are skipped.
+func (r *ElasticsearchRepo) Reindex(sources []string, dest string, since *time.Time, script map[string]interface{}) error {
+	source := map[string]interface{}{"index": sources}
+	if since != nil {
+		source["query"] = map[string]interface{}{
+			"range": map[string]interface{}{
+				"updated_at": map[string]interface{}{"gte": since.Format("2006-01-02T15:04:05.000Z07:00")},
+			},
+		}
+	}
+	request := map[string]interface{}{
+		"conflicts": "proceed",
+		"source":    source,
+		// Keep the versions of the source, so that a copy never overwrites
+		// a newer document
+		"dest": map[string]string{"index": dest, "version_type": "external"},
+	}
+	if script != nil {
+		request["script"] = script
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("error marshaling reindex request: %w", err)
+	}
+
+	res, err := r.client.Reindex(bytes.NewReader(body),
+		r.client.Reindex.WithWaitForCompletion(true),
+		r.client.Reindex.WithRefresh(true),
+	)
+	if err != nil {
+		log.Printf("Reindex: Failed to reindex %v into %s: %v", sources, dest, err)
+		return fmt.Errorf("failed to reindex into %s: %w", dest, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("Reindex: Elasticsearch error: %s", res.String())
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	log.Printf("Reindex: Reindexed %v", sources)
+	return nil
+}
+
+// ListIndices returns the open or closed status of every index matching
+// pattern.
+func (r *ElasticsearchRepo) ListIndices(pattern string) (map[string]string, error) {
+	res, err := r.client.Cat.Indices(
+		r.client.Cat.Indices.WithIndex(pattern),
+		r.client.Cat.Indices.WithFormat("json"),
+		r.client.Cat.Indices.WithH("index", "status"),
+		r.client.Cat.Indices.WithExpandWildcards("all"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indices %s: %w", pattern, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.IsError() {
+		log.Printf("ListIndices: Elasticsearch error: %s", res.String())
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var rows []struct {
+		Index  string `json:"index"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to decode indices %s: %w", pattern, err)
+	}
+	indices := make(map[string]string, len(rows))
+	for _, row := range rows {
+		indices[row.Index] = row.Status
+	}
+	return indices, nil
+}
+
+// CloseIndex closes an index, keeping its data on disk but out of searches.
+func (r *ElasticsearchRepo) CloseIndex(index string) error {
+	res, err := r.client.Indices.Close([]string{index})
+	if err != nil {
+		log.Printf("CloseIndex: Failed to close index %s: %v", index, err)
+		return fmt.Errorf("failed to close index %s: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("CloseIndex: Elasticsearch error: %s", res.String())
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	return nil
+}
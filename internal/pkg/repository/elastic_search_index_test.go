@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	config "notifications/configurations"
+	"notifications/internal/models"
+)
+
+// elasticsearchTestAddr names the environment variable pointing the tests that
+// need a cluster at one. They are skipped without it.
+const elasticsearchTestAddr = "ELASTICSEARCH_TEST_ADDR"
+
+func TestSMSTemplateAliases(t *testing.T) {
+	for _, readable := range []bool{true, false} {
+		template, err := smsTemplate(readable)
+		if err != nil {
+			t.Fatalf("smsTemplate(%v): %v", readable, err)
+		}
+		var parsed struct {
+			Settings map[string]interface{}            `json:"settings"`
+			Mappings map[string]interface{}            `json:"mappings"`
+			Aliases  map[string]map[string]interface{} `json:"aliases"`
+		}
+		if err := json.Unmarshal([]byte(template), &parsed); err != nil {
+			t.Fatalf("smsTemplate(%v) returned invalid JSON: %v", readable, err)
+		}
+		if parsed.Settings == nil || parsed.Mappings == nil {
+			t.Errorf("smsTemplate(%v) lost the settings or mappings: %s", readable, template)
+		}
+		_, aliased := parsed.Aliases[config.ElasticsearchSMSAlias]
+		if aliased != readable {
+			t.Errorf("smsTemplate(%v) joins the read alias: %v, want %v", readable, aliased, readable)
+		}
+		if len(parsed.Aliases) > 1 {
+			t.Errorf("smsTemplate(%v) adds unexpected aliases: %v", readable, parsed.Aliases)
+		}
+	}
+}
+
+// TestNewPeriodIndexIsSearchable writes an SMS of a period that has no index
+// yet and finds it through the read alias.
+func TestNewPeriodIndexIsSearchable(t *testing.T) {
+	addr := os.Getenv(elasticsearchTestAddr)
+	if addr == "" {
+		t.Skipf("%s not set", elasticsearchTestAddr)
+	}
+	repo, err := NewElasticSearch(addr)
+	if err != nil {
+		t.Fatalf("NewElasticSearch: %v", err)
+	}
+	if err := repo.putSMSTemplate(true); err != nil {
+		t.Fatalf("putSMSTemplate: %v", err)
+	}
+
+	createdAt := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	index := SMSIndexName(createdAt)
+	if err := repo.DeleteIndex(index); err != nil {
+		t.Logf("DeleteIndex %s: %v", index, err)
+	}
+	defer repo.DeleteIndex(index)
+
+	sms := models.SMS{ID: "period-test-1", TenantID: "period-test", PhoneNumber: "+919876543210", Message: "hello", Status: "Successful"}
+	doc, err := NewSMSDocument(sms, createdAt, createdAt)
+	if err != nil {
+		t.Fatalf("NewSMSDocument: %v", err)
+	}
+	if doc.Index != index {
+		t.Fatalf("NewSMSDocument wrote to %s, want %s", doc.Index, index)
+	}
+	failed, err := repo.BulkIndexSMS([]SMSDocument{doc})
+	if err != nil || len(failed) > 0 {
+		t.Fatalf("BulkIndexSMS: %d failed, %v", len(failed), err)
+	}
+	if err := repo.Refresh(config.ElasticsearchSMSAlias); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	res, err := repo.Search(config.ElasticsearchSMSAlias, `{"query":{"ids":{"values":["period-test-1"]}}}`)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	defer res.Body.Close()
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				Index string `json:"_index"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding search response: %v", err)
+	}
+	if len(response.Hits.Hits) != 1 || response.Hits.Hits[0].Index != index {
+		t.Fatalf("searching %s found %+v, want the SMS in %s", config.ElasticsearchSMSAlias, response.Hits.Hits, index)
+	}
+}
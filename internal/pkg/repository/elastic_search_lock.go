@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	config "notifications/configurations"
+)
+
+// smsMigrationLockIndex holds one lock document per mapping version, created
+// by the instance migrating the SMS indices to that version.
+const smsMigrationLockIndex = "sms_migration_lock"
+
+// migrationLock is the lock document. The lock expires at ExpiresAt, so an
+// instance that died while migrating doesn't hold it forever.
+type migrationLock struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// storedMigrationLock is a lock document with the sequence number and primary
+// term it was read at, to replace or remove it only if nobody changed it since.
+type storedMigrationLock struct {
+	migrationLock
+	seqNo       int
+	primaryTerm int
+}
+
+func smsMigrationLockID() string {
+	return fmt.Sprintf("v%d", SMSMappingVersion)
+}
+
+// migrationLockOwner identifies this process in the lock document.
+func migrationLockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// acquireMigrationLock takes the migration lock of the current mapping
+// version. It reports false if another instance holds it; a lock whose lease
+// ran out is taken over.
+func (r *ElasticsearchRepo) acquireMigrationLock() (bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		created, err := r.createMigrationLock()
+		if err != nil || created {
+			return created, err
+		}
+
+		lock, err := r.getMigrationLock()
+		if err != nil {
+			return false, err
+		}
+		if lock == nil {
+			// Released in the meantime
+			continue
+		}
+		if time.Now().Before(lock.ExpiresAt) {
+			return false, nil
+		}
+		log.Printf("acquireMigrationLock: Taking over the lock of %s, expired at %s", lock.Owner, lock.ExpiresAt)
+		deleted, err := r.deleteMigrationLock(lock)
+		if err != nil || !deleted {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// releaseMigrationLock drops the lock if this process still holds it.
+// Failures are only logged; the lease frees the lock eventually.
+func (r *ElasticsearchRepo) releaseMigrationLock() {
+	lock, err := r.getMigrationLock()
+	if err == nil && lock != nil && lock.Owner == migrationLockOwner() {
+		_, err = r.deleteMigrationLock(lock)
+	}
+	if err != nil {
+		log.Printf("releaseMigrationLock: Failed to release the migration lock: %v", err)
+	}
+}
+
+// migrationLocked reports whether an instance holds an unexpired migration
+// lock of the current mapping version.
+func (r *ElasticsearchRepo) migrationLocked() (bool, error) {
+	lock, err := r.getMigrationLock()
+	if err != nil || lock == nil {
+		return false, err
+	}
+	return time.Now().Before(lock.ExpiresAt), nil
+}
+
+// createMigrationLock creates the lock document, reporting false if it
+// already exists.
+func (r *ElasticsearchRepo) createMigrationLock() (bool, error) {
+	body, err := json.Marshal(migrationLock{
+		Owner:     migrationLockOwner(),
+		ExpiresAt: time.Now().Add(config.ElasticsearchMigrationLease),
+	})
+	if err != nil {
+		return false, fmt.Errorf("error marshaling migration lock: %w", err)
+	}
+
+	res, err := r.client.Create(smsMigrationLockIndex, smsMigrationLockID(), bytes.NewReader(body),
+		r.client.Create.WithRefresh("true"),
+	)
+	if err != nil {
+		log.Printf("createMigrationLock: Failed to create migration lock: %v", err)
+		return false, fmt.Errorf("failed to create migration lock: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusConflict {
+		return false, nil
+	}
+	if res.IsError() {
+		log.Printf("createMigrationLock: Elasticsearch error: %s", res.String())
+		return false, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	return true, nil
+}
+
+// getMigrationLock returns the lock document, or nil if there is none.
+func (r *ElasticsearchRepo) getMigrationLock() (*storedMigrationLock, error) {
+	res, err := r.client.Get(smsMigrationLockIndex, smsMigrationLockID())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration lock: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.IsError() {
+		log.Printf("getMigrationLock: Elasticsearch error: %s", res.String())
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var doc struct {
+		SeqNo       int           `json:"_seq_no"`
+		PrimaryTerm int           `json:"_primary_term"`
+		Source      migrationLock `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode migration lock: %w", err)
+	}
+	return &storedMigrationLock{migrationLock: doc.Source, seqNo: doc.SeqNo, primaryTerm: doc.PrimaryTerm}, nil
+}
+
+// deleteMigrationLock deletes the lock document if it is still the one that
+// was read, reporting false if it changed or is gone.
+func (r *ElasticsearchRepo) deleteMigrationLock(lock *storedMigrationLock) (bool, error) {
+	res, err := r.client.Delete(smsMigrationLockIndex, smsMigrationLockID(),
+		r.client.Delete.WithIfSeqNo(lock.seqNo),
+		r.client.Delete.WithIfPrimaryTerm(lock.primaryTerm),
+		r.client.Delete.WithRefresh("true"),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete migration lock: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusConflict || res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if res.IsError() {
+		log.Printf("deleteMigrationLock: Elasticsearch error: %s", res.String())
+		return false, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	return true, nil
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// ErrInvalidCursor is returned for a cursor that can't be decoded or whose
+// point in time has expired.
+var ErrInvalidCursor = errors.New("invalid or expired cursor")
+
+// ErrInvalidPageSize is returned for a search whose page size isn't positive.
+var ErrInvalidPageSize = errors.New("page size must be positive")
+
+// How long a point in time stays open between two pages
+const searchKeepAlive = "2m"
+
+// SMSSort returns a stable order on field, with the SMS ID breaking ties.
+// Pages are returned by creation time unless a search asks otherwise.
+func SMSSort(field string, descending bool) []map[string]string {
+	order := "asc"
+	if descending {
+		order = "desc"
+	}
+	return []map[string]string{
+		{field: order},
+		{"id": order},
+	}
+}
+
+// SearchRequest is a page of a search. Query and Highlight are the query and
+// highlight clauses of the search body; Sort defaults to SMSSort("created_at",
+// false) and has to stay the same for every page of a search.
+type SearchRequest struct {
+	Query     json.RawMessage
+	Highlight json.RawMessage
+	Sort      []map[string]string
+	Limit     int
+	Cursor    string
+}
+
+// SearchPage is one page of search hits. NextCursor is empty on the last page.
+// Highlights holds the highlighted fragments of Hits[i] at the same index, if
+// highlighting was asked for.
+type SearchPage struct {
+	Hits       []map[string]interface{}
+	Highlights []map[string][]string
+	Total      int64
+	NextCursor string
+}
+
+// searchCursor is the decoded form of a page cursor: the point in time the
+// first page was read from and the sort values of the last hit returned.
+type searchCursor struct {
+	PitID       string        `json:"pit"`
+	SearchAfter []interface{} `json:"after"`
+}
+
+func encodeCursor(cursor searchCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(raw string) (searchCursor, error) {
+	var cursor searchCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.PitID == "" || len(cursor.SearchAfter) == 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// SearchAfter returns one page of up to search.Limit hits of search.Query, in
+// search.Sort order. The first page opens a point in time on index so that
+// later pages, requested with the returned cursor, see the same snapshot; it
+// is closed once the last page is read.
+func (r *ElasticsearchRepo) SearchAfter(index string, search SearchRequest) (*SearchPage, error) {
+	// An empty page would leave no hit to continue after
+	if search.Limit <= 0 {
+		return nil, ErrInvalidPageSize
+	}
+	var cursor searchCursor
+	if search.Cursor != "" {
+		decoded, err := decodeCursor(search.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursor = decoded
+	} else {
+		pitID, err := r.openPointInTime(index)
+		if err != nil {
+			return nil, err
+		}
+		cursor.PitID = pitID
+	}
+
+	body, err := json.Marshal(searchAfterBody(search, cursor))
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling search request: %w", err)
+	}
+
+	// Searches on a point in time must not name an index
+	res, err := r.client.Search(
+		r.client.Search.WithContext(context.Background()),
+		r.client.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents in index %s: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound && search.Cursor != "" {
+		return nil, ErrInvalidCursor
+	}
+	if res.IsError() {
+		log.Printf("SearchAfter: Elasticsearch error: %s", res.String())
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var response struct {
+		PitID string `json:"pit_id"`
+		Hits  struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Source    map[string]interface{} `json:"_source"`
+				Highlight map[string][]string    `json:"highlight"`
+				Sort      []interface{}          `json:"sort"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+
+	page := &SearchPage{Total: response.Hits.Total.Value, Hits: make([]map[string]interface{}, 0, len(response.Hits.Hits))}
+	for _, hit := range response.Hits.Hits {
+		page.Hits = append(page.Hits, hit.Source)
+		if len(search.Highlight) > 0 {
+			page.Highlights = append(page.Highlights, hit.Highlight)
+		}
+	}
+
+	// Elasticsearch may hand out a new ID for the same point in time
+	if response.PitID != "" {
+		cursor.PitID = response.PitID
+	}
+	if len(response.Hits.Hits) < search.Limit {
+		r.closePointInTime(cursor.PitID)
+		return page, nil
+	}
+	cursor.SearchAfter = response.Hits.Hits[len(response.Hits.Hits)-1].Sort
+	if page.NextCursor, err = encodeCursor(cursor); err != nil {
+		return nil, fmt.Errorf("error encoding cursor: %w", err)
+	}
+	return page, nil
+}
+
+// searchAfterBody returns the body of the search for the page of search that
+// follows cursor.
+func searchAfterBody(search SearchRequest, cursor searchCursor) map[string]interface{} {
+	sort := search.Sort
+	if len(sort) == 0 {
+		sort = SMSSort("created_at", false)
+	}
+	request := map[string]interface{}{
+		"query":            search.Query,
+		"size":             search.Limit,
+		"sort":             sort,
+		"track_total_hits": true,
+		"pit":              map[string]string{"id": cursor.PitID, "keep_alive": searchKeepAlive},
+	}
+	if len(search.Highlight) > 0 {
+		request["highlight"] = search.Highlight
+	}
+	if len(cursor.SearchAfter) > 0 {
+		request["search_after"] = cursor.SearchAfter
+	}
+	return request
+}
+
+func (r *ElasticsearchRepo) openPointInTime(index string) (string, error) {
+	res, err := r.client.OpenPointInTime([]string{index}, searchKeepAlive,
+		r.client.OpenPointInTime.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to open point in time on %s: %w", index, err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Printf("openPointInTime: Elasticsearch error: %s", res.String())
+		return "", fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to decode point in time: %w", err)
+	}
+	return response.ID, nil
+}
+
+// closePointInTime releases a point in time early. It expires by itself, so
+// failures are only logged.
+func (r *ElasticsearchRepo) closePointInTime(pitID string) {
+	body, _ := json.Marshal(map[string]string{"id": pitID})
+	res, err := r.client.ClosePointInTime(r.client.ClosePointInTime.WithBody(bytes.NewReader(body)))
+	if err != nil {
+		log.Printf("closePointInTime: Failed to close point in time: %v", err)
+		return
+	}
+	res.Body.Close()
+}
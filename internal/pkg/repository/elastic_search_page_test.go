@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// decodeBody marshals a search body and decodes it back into plain JSON
+// values, as Elasticsearch receives it.
+func decodeBody(t *testing.T, body map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	return decoded
+}
+
+func TestSearchAfterBodyFirstPage(t *testing.T) {
+	search := SearchRequest{
+		Query: json.RawMessage(`{"bool":{"filter":[{"term":{"tenant_id":"tenant-1"}}]}}`),
+		Limit: 50,
+	}
+
+	got := decodeBody(t, searchAfterBody(search, searchCursor{PitID: "pit-1"}))
+
+	want := map[string]interface{}{
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"filter": []interface{}{map[string]interface{}{"term": map[string]interface{}{"tenant_id": "tenant-1"}}},
+		}},
+		"size":             float64(50),
+		"sort":             []interface{}{map[string]interface{}{"created_at": "asc"}, map[string]interface{}{"id": "asc"}},
+		"track_total_hits": true,
+		"pit":              map[string]interface{}{"id": "pit-1", "keep_alive": searchKeepAlive},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("first page body = %v, want %v", got, want)
+	}
+}
+
+func TestSearchAfterBodyNextPage(t *testing.T) {
+	raw, err := encodeCursor(searchCursor{PitID: "pit-2", SearchAfter: []interface{}{"2024-03-01T10:00:00Z", "1234"}})
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+	cursor, err := decodeCursor(raw)
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	search := SearchRequest{
+		Query:     json.RawMessage(`{"match_all":{}}`),
+		Highlight: json.RawMessage(`{"fields":{"message":{}}}`),
+		Sort:      SMSSort("updated_at", true),
+		Limit:     10,
+		Cursor:    raw,
+	}
+
+	got := decodeBody(t, searchAfterBody(search, cursor))
+
+	if want := []interface{}{"2024-03-01T10:00:00Z", "1234"}; !reflect.DeepEqual(got["search_after"], want) {
+		t.Errorf("search_after = %v, want %v", got["search_after"], want)
+	}
+	if want := map[string]interface{}{"id": "pit-2", "keep_alive": searchKeepAlive}; !reflect.DeepEqual(got["pit"], want) {
+		t.Errorf("pit = %v, want %v", got["pit"], want)
+	}
+	if want := []interface{}{map[string]interface{}{"updated_at": "desc"}, map[string]interface{}{"id": "desc"}}; !reflect.DeepEqual(got["sort"], want) {
+		t.Errorf("sort = %v, want %v", got["sort"], want)
+	}
+	if want := map[string]interface{}{"fields": map[string]interface{}{"message": map[string]interface{}{}}}; !reflect.DeepEqual(got["highlight"], want) {
+		t.Errorf("highlight = %v, want %v", got["highlight"], want)
+	}
+	if _, ok := got["index"]; ok {
+		t.Errorf("a search on a point in time must not name an index: %v", got)
+	}
+}
+
+func TestDecodeCursorRejectsInvalidCursors(t *testing.T) {
+	noPosition, err := encodeCursor(searchCursor{PitID: "pit-1"})
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+	for _, raw := range []string{"not base64!", "bm90IGpzb24", noPosition} {
+		if _, err := decodeCursor(raw); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) = %v, want ErrInvalidCursor", raw, err)
+		}
+	}
+}
+
+func TestSearchAfterRejectsEmptyPages(t *testing.T) {
+	repo := &ElasticsearchRepo{}
+	for _, limit := range []int{0, -1} {
+		if _, err := repo.SearchAfter("sms", SearchRequest{Limit: limit}); !errors.Is(err, ErrInvalidPageSize) {
+			t.Errorf("SearchAfter with limit %d = %v, want ErrInvalidPageSize", limit, err)
+		}
+	}
+}
@@ -1,14 +1,12 @@
 package repository
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"notifications/internal/models"
 	"strings"
-	"time"
+	"sync"
 	"notifications/configurations"
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
@@ -29,53 +27,6 @@ func NewElasticSearch(addr string) (*ElasticsearchRepo, error) {
 	}
 	return &ElasticsearchRepo{client: client}, nil
 }
-func (r *ElasticsearchRepo) CreateIndex(index string) error {
-	// Check if the index exists and delete it
-	if exists, err := r.IndexExists(index); err != nil {
-		return err
-	} else if exists {
-		if err := r.DeleteIndex(index); err != nil {
-			return err
-		}
-	}
-
-	// Define the mapping with date formats
-	mapping := `{
-		"mappings": {
-			"properties": {
-				"created_at": {
-					"type": "date",
-					"format": "strict_date_time"
-				},
-				"updated_at": {
-					"type": "date",
-					"format": "strict_date_time"
-				}
-			}
-		}
-	}`
-
-	req := esapi.IndicesCreateRequest{
-		Index: index,
-		Body:  strings.NewReader(mapping),
-	}
-
-	res, err := req.Do(context.Background(), r.client)
-	if err != nil {
-		log.Printf("CreateIndex: Failed to create index %s: %v", index, err)
-		return fmt.Errorf("failed to create index %s: %w", index, err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		log.Printf("CreateIndex: Elasticsearch error: %s", res.String())
-		return fmt.Errorf("elasticsearch error: %s", res.String())
-	}
-
-	log.Printf("CreateIndex: Index %s created successfully", index)
-	return nil
-}
-
 // Helper function to check if an index exists
 func (r *ElasticsearchRepo) IndexExists(index string) (bool, error) {
 	res, err := r.client.Indices.Exists([]string{index})
@@ -197,41 +148,6 @@ func (r *ElasticsearchRepo) DeleteDocument(index string, id string) error {
 	return nil
 }
 
-func (e *ElasticsearchRepo) CreateIndexSMS(sms models.SMS, dur time.Duration) error {
-	// Format the dates
-	
-	updatedAt := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
-	createdAt := time.Now().UTC().Add(5*time.Hour + 30*time.Minute - dur)
-	// Prepare the document
-	doc := map[string]interface{}{
-		"id":               sms.ID,
-		"phone_number":     sms.PhoneNumber,
-		"message":          sms.Message,
-		"status":           sms.Status,
-		"failure_comments": sms.FailureComments,
-		"created_at":       createdAt,
-		"updated_at":       updatedAt,
-	}
-
-	// Convert the document to JSON
-	body, err := json.Marshal(doc)
-	if err != nil {
-		return fmt.Errorf("error marshaling document to JSON: %w", err)
-	}
-	// Index the document in Elasticsearch
-	_, err = e.client.Index(
-		"sms_index", // Index name
-		bytes.NewReader(body),
-		e.client.Index.WithDocumentID(sms.ID),
-		e.client.Index.WithRefresh("true"), // Ensures the index is refreshed after the operation
-	)
-	if err != nil {
-		return fmt.Errorf("error indexing document in Elasticsearch: %w", err)
-	}
-
-	return nil
-}
-
 // In repository/elasticsearchrepo.go
 func (r *ElasticsearchRepo) Search(index string, query string) (*esapi.Response, error) {
 	res, err := r.client.Search(
@@ -239,19 +155,32 @@ func (r *ElasticsearchRepo) Search(index string, query string) (*esapi.Response,
 		r.client.Search.WithIndex(index),
 		r.client.Search.WithBody(strings.NewReader(query)),
 		r.client.Search.WithSize(10000), // Adjust size as needed
+		// Index lists may name periods that have no index yet or were closed
+		r.client.Search.WithIgnoreUnavailable(true),
+		r.client.Search.WithAllowNoIndices(true),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search documents in index %s: %w", index, err)
 	}
 	return res, nil
 }
+// The SMS indices are prepared once per process, however many services get
+// the repository
+var (
+	ensureSMSIndexOnce sync.Once
+	ensureSMSIndexErr  error
+)
+
 func GetElasticRepo()(*ElasticsearchRepo,error){
 	elasticRepo, err := NewElasticSearch(config.ElasticsearchAddr)
 	if err != nil {
 		return nil, err
 	}
-	if err := elasticRepo.CreateIndex("sms_index"); err != nil {
-		return nil, err
+	ensureSMSIndexOnce.Do(func() {
+		ensureSMSIndexErr = elasticRepo.EnsureSMSIndex()
+	})
+	if ensureSMSIndexErr != nil {
+		return nil, ensureSMSIndexErr
 	}
 	return elasticRepo,nil
 }
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"log"
 	"notifications/internal/models"
+	"sync"
 	"time"
 	"notifications/configurations"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MySQLRepo struct {
@@ -23,15 +25,11 @@ func NewMySQL(dsn string) (*MySQLRepo, error) {
 	return &MySQLRepo{db: db}, nil
 }
 
+// Migrate creates missing tables and columns. Nothing is ever dropped: the
+// SMS are indexed in Elasticsearch under their IDs, so the rows must outlive
+// restarts.
 func (r *MySQLRepo) Migrate() error {
-	if err := r.db.Migrator().DropTable(&models.SMS{}); err != nil {
-		log.Printf("Migrate: Failed to drop existing tables: %v", err)
-		return fmt.Errorf("failed to drop tables: %w", err)
-	}
-	log.Println("Migrate: Dropped existing tables successfully")
-
-	// AutoMigrate the SMS model
-	if err := r.db.AutoMigrate(&models.SMS{}); err != nil {
+	if err := r.db.AutoMigrate(&models.SMS{}, &models.APIKey{}, &models.Tenant{}, &models.BlacklistEntry{}, &models.BlacklistRule{}, &models.BlacklistEvent{}, &models.SMSIndexBacklog{}, &models.BackfillCheckpoint{}); err != nil {
 		log.Printf("Migrate: Failed to migrate database: %v", err)
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -40,6 +38,14 @@ func (r *MySQLRepo) Migrate() error {
 	return nil
 }
 
+// Transaction runs fn with a repository bound to a single transaction, which
+// is committed if fn returns nil and rolled back otherwise.
+func (r *MySQLRepo) Transaction(fn func(tx *MySQLRepo) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&MySQLRepo{db: tx})
+	})
+}
+
 func (r *MySQLRepo) Create(s *models.SMS) error {
 	if err := r.db.Create(s).Error; err != nil {
 		log.Printf("Create: Failed to create SMS record: %v", err)
@@ -54,11 +60,13 @@ func (r *MySQLRepo) Raw(query string, args ...interface{}) *gorm.DB {
 	return r.db.Raw(query, args...)
 }
 
-func (r *MySQLRepo) UpdateSMSStatus(id, status, failureComments string) error {
+// UpdateSMSStatus sets the status and failure comments of the SMS, changed at
+// updatedAt.
+func (r *MySQLRepo) UpdateSMSStatus(id, status, failureComments string, updatedAt time.Time) error {
 	if err := r.db.Model(&models.SMS{}).Where("id = ?", id).Updates(map[string]interface{}{
 		"status":           status,
 		"failure_comments": failureComments,
-		"updated_at":       time.Now().UTC().Add(5*time.Hour + 30*time.Minute),
+		"updated_at":       updatedAt,
 	}).Error; err != nil {
 		log.Printf("UpdateSMSStatus: Failed to update SMS status for ID %s: %v", id, err)
 		return err
@@ -66,6 +74,437 @@ func (r *MySQLRepo) UpdateSMSStatus(id, status, failureComments string) error {
 	log.Printf("UpdateSMSStatus: Updated SMS status for ID %s successfully", id)
 	return nil
 }
+// FindSMS returns the tenant's SMS rows matching every non-empty filter:
+// status, a created_at range and a list of IDs. Rows are returned in ID order.
+func (r *MySQLRepo) FindSMS(tenantID, status string, from, to time.Time, ids []string) ([]models.SMS, error) {
+	query := r.db.Model(&models.SMS{}).Where("tenant_id = ?", tenantID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+
+	var smsList []models.SMS
+	if err := query.Order("id").Find(&smsList).Error; err != nil {
+		log.Printf("FindSMS: Failed to query SMS records: %v", err)
+		return nil, err
+	}
+	log.Printf("FindSMS: Found %d SMS records", len(smsList))
+	return smsList, nil
+}
+
+func (r *MySQLRepo) CreateAPIKey(key *models.APIKey) error {
+	if err := r.db.Create(key).Error; err != nil {
+		log.Printf("CreateAPIKey: Failed to create API key for client %s: %v", key.ClientID, err)
+		return err
+	}
+	log.Printf("CreateAPIKey: API key created for client %s", key.ClientID)
+	return nil
+}
+
+// FindAPIKeyByHash returns the active API key with the given hash, or nil if
+// there is none.
+func (r *MySQLRepo) FindAPIKeyByHash(hash string) (*models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.Where("key_hash = ? AND revoked_at IS NULL", hash).Limit(1).Find(&keys).Error; err != nil {
+		log.Printf("FindAPIKeyByHash: Failed to look up API key: %v", err)
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return &keys[0], nil
+}
+
+// CountSMSSince returns how many SMS the tenant created at or after since.
+func (r *MySQLRepo) CountSMSSince(tenantID string, since time.Time) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.SMS{}).Where("tenant_id = ? AND created_at >= ?", tenantID, since).Count(&count).Error; err != nil {
+		log.Printf("CountSMSSince: Failed to count SMS for tenant %s: %v", tenantID, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetTenant returns the tenant with the given ID, or nil if it doesn't exist.
+func (r *MySQLRepo) GetTenant(id string) (*models.Tenant, error) {
+	var tenants []models.Tenant
+	if err := r.db.Where("id = ?", id).Limit(1).Find(&tenants).Error; err != nil {
+		log.Printf("GetTenant: Failed to retrieve tenant %s: %v", id, err)
+		return nil, err
+	}
+	if len(tenants) == 0 {
+		return nil, nil
+	}
+	return &tenants[0], nil
+}
+
+// SaveTenant creates the tenant or replaces its settings.
+func (r *MySQLRepo) SaveTenant(tenant *models.Tenant) error {
+	if err := r.db.Save(tenant).Error; err != nil {
+		log.Printf("SaveTenant: Failed to save tenant %s: %v", tenant.ID, err)
+		return err
+	}
+	log.Printf("SaveTenant: Tenant %s saved successfully", tenant.ID)
+	return nil
+}
+
+// AddBlacklistEntry stores the entry, replacing the metadata of an existing
+// entry for the same tenant and number.
+func (r *MySQLRepo) AddBlacklistEntry(entry *models.BlacklistEntry) error {
+	err := r.db.Where("tenant_id = ? AND phone_number = ?", entry.TenantID, entry.PhoneNumber).
+		Assign(map[string]interface{}{
+			"reason":     entry.Reason,
+			"source":     entry.Source,
+			"added_by":   entry.AddedBy,
+			"expires_at": entry.ExpiresAt,
+		}).
+		FirstOrCreate(entry).Error
+	if err != nil {
+		log.Printf("AddBlacklistEntry: Failed to store %s for tenant %s: %v", entry.PhoneNumber, entry.TenantID, err)
+		return err
+	}
+	return nil
+}
+
+// InsertBlacklistEntries stores the entries in one statement, replacing the
+// metadata of numbers the tenant already blacklisted, like AddBlacklistEntry.
+func (r *MySQLRepo) InsertBlacklistEntries(entries []models.BlacklistEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	upsert := clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"reason", "source", "added_by", "expires_at"})}
+	if err := r.db.Clauses(upsert).Create(&entries).Error; err != nil {
+		log.Printf("InsertBlacklistEntries: Failed to store %d entries: %v", len(entries), err)
+		return err
+	}
+	return nil
+}
+
+// FindBlacklistedNumbers returns which of the numbers are on the tenant's blacklist.
+func (r *MySQLRepo) FindBlacklistedNumbers(tenantID string, numbers []string) ([]string, error) {
+	var found []string
+	if err := r.db.Model(&models.BlacklistEntry{}).Where("tenant_id = ? AND phone_number IN ?", tenantID, numbers).Pluck("phone_number", &found).Error; err != nil {
+		log.Printf("FindBlacklistedNumbers: Failed to query blacklist for tenant %s: %v", tenantID, err)
+		return nil, err
+	}
+	return found, nil
+}
+
+// StreamBlacklistEntries calls fn for each of the tenant's entries in ID order
+// without loading the whole blacklist into memory.
+func (r *MySQLRepo) StreamBlacklistEntries(tenantID string, fn func(entry models.BlacklistEntry) error) error {
+	rows, err := r.db.Model(&models.BlacklistEntry{}).Where("tenant_id = ?", tenantID).Order("id").Rows()
+	if err != nil {
+		log.Printf("StreamBlacklistEntries: Failed to query blacklist for tenant %s: %v", tenantID, err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.BlacklistEntry
+		if err := r.db.ScanRows(rows, &entry); err != nil {
+			log.Printf("StreamBlacklistEntries: Error scanning row: %v", err)
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DeleteBlacklistEntry removes the number from the tenant's blacklist and
+// reports whether it was there.
+func (r *MySQLRepo) DeleteBlacklistEntry(tenantID, number string) (bool, error) {
+	result := r.db.Where("tenant_id = ? AND phone_number = ?", tenantID, number).Delete(&models.BlacklistEntry{})
+	if result.Error != nil {
+		log.Printf("DeleteBlacklistEntry: Failed to delete %s for tenant %s: %v", number, tenantID, result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteExpiredBlacklistEntry deletes the tenant's entry for number only if it
+// expired at or before now, reporting whether it did. An entry extended or
+// re-added since it was found expired is kept.
+func (r *MySQLRepo) DeleteExpiredBlacklistEntry(tenantID, number string, now time.Time) (bool, error) {
+	result := r.db.Where("tenant_id = ? AND phone_number = ? AND expires_at IS NOT NULL AND expires_at <= ?", tenantID, number, now).Delete(&models.BlacklistEntry{})
+	if result.Error != nil {
+		log.Printf("DeleteExpiredBlacklistEntry: Failed to delete %s for tenant %s: %v", number, tenantID, result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetBlacklistEntry returns the tenant's entry for number, or nil if there is none.
+func (r *MySQLRepo) GetBlacklistEntry(tenantID, number string) (*models.BlacklistEntry, error) {
+	var entries []models.BlacklistEntry
+	if err := r.db.Where("tenant_id = ? AND phone_number = ?", tenantID, number).Limit(1).Find(&entries).Error; err != nil {
+		log.Printf("GetBlacklistEntry: Failed to retrieve %s for tenant %s: %v", number, tenantID, err)
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// ListBlacklistEntries returns every entry on the tenant's blacklist.
+func (r *MySQLRepo) ListBlacklistEntries(tenantID string) ([]models.BlacklistEntry, error) {
+	var entries []models.BlacklistEntry
+	if err := r.db.Where("tenant_id = ?", tenantID).Find(&entries).Error; err != nil {
+		log.Printf("ListBlacklistEntries: Failed to list blacklist for tenant %s: %v", tenantID, err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListExpiredBlacklistEntries returns the entries of all tenants whose expiry
+// is at or before now.
+func (r *MySQLRepo) ListExpiredBlacklistEntries(now time.Time) ([]models.BlacklistEntry, error) {
+	var entries []models.BlacklistEntry
+	if err := r.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&entries).Error; err != nil {
+		log.Printf("ListExpiredBlacklistEntries: Failed to list expired entries: %v", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListBlacklistNumbers returns every number on the tenant's blacklist.
+func (r *MySQLRepo) ListBlacklistNumbers(tenantID string) ([]string, error) {
+	var numbers []string
+	if err := r.db.Model(&models.BlacklistEntry{}).Where("tenant_id = ?", tenantID).Pluck("phone_number", &numbers).Error; err != nil {
+		log.Printf("ListBlacklistNumbers: Failed to list blacklist for tenant %s: %v", tenantID, err)
+		return nil, err
+	}
+	return numbers, nil
+}
+
+// ListBlacklistTenants returns every tenant that has at least one blacklist entry.
+func (r *MySQLRepo) ListBlacklistTenants() ([]string, error) {
+	var tenants []string
+	if err := r.db.Model(&models.BlacklistEntry{}).Distinct().Pluck("tenant_id", &tenants).Error; err != nil {
+		log.Printf("ListBlacklistTenants: Failed to list tenants: %v", err)
+		return nil, err
+	}
+	return tenants, nil
+}
+
+func (r *MySQLRepo) CreateBlacklistRule(rule *models.BlacklistRule) error {
+	if err := r.db.Create(rule).Error; err != nil {
+		log.Printf("CreateBlacklistRule: Failed to create rule for tenant %s: %v", rule.TenantID, err)
+		return err
+	}
+	log.Printf("CreateBlacklistRule: Rule %d created for tenant %s", rule.ID, rule.TenantID)
+	return nil
+}
+
+// DeleteBlacklistRule deletes the tenant's rule and reports whether it existed.
+func (r *MySQLRepo) DeleteBlacklistRule(tenantID string, id uint) (bool, error) {
+	result := r.db.Where("tenant_id = ? AND id = ?", tenantID, id).Delete(&models.BlacklistRule{})
+	if result.Error != nil {
+		log.Printf("DeleteBlacklistRule: Failed to delete rule %d for tenant %s: %v", id, tenantID, result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *MySQLRepo) ListBlacklistRules(tenantID string) ([]models.BlacklistRule, error) {
+	var rules []models.BlacklistRule
+	if err := r.db.Where("tenant_id = ?", tenantID).Order("id").Find(&rules).Error; err != nil {
+		log.Printf("ListBlacklistRules: Failed to list rules for tenant %s: %v", tenantID, err)
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ListBlacklistRuleTenants returns every tenant that has at least one rule.
+func (r *MySQLRepo) ListBlacklistRuleTenants() ([]string, error) {
+	var tenants []string
+	if err := r.db.Model(&models.BlacklistRule{}).Distinct().Pluck("tenant_id", &tenants).Error; err != nil {
+		log.Printf("ListBlacklistRuleTenants: Failed to list tenants: %v", err)
+		return nil, err
+	}
+	return tenants, nil
+}
+
+func (r *MySQLRepo) CreateBlacklistEvents(events []models.BlacklistEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := r.db.Create(&events).Error; err != nil {
+		log.Printf("CreateBlacklistEvents: Failed to store %d events: %v", len(events), err)
+		return err
+	}
+	return nil
+}
+
+// LockPendingBlacklistEvents returns up to limit unpublished events, oldest
+// first, locking them until the transaction ends so that one instance at a
+// time claims events.
+func (r *MySQLRepo) LockPendingBlacklistEvents(limit int) ([]models.BlacklistEvent, error) {
+	var events []models.BlacklistEvent
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("published_at IS NULL").Order("id").Limit(limit).Find(&events).Error
+	if err != nil {
+		log.Printf("LockPendingBlacklistEvents: Failed to list events: %v", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// ClaimBlacklistEvents records owner as the instance relaying the events
+// until the given time.
+func (r *MySQLRepo) ClaimBlacklistEvents(ids []uint, owner string, until time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := r.db.Model(&models.BlacklistEvent{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"claimed_by": owner, "claimed_until": until}).Error
+	if err != nil {
+		log.Printf("ClaimBlacklistEvents: Failed to claim %d events: %v", len(ids), err)
+		return err
+	}
+	return nil
+}
+
+// ReleaseBlacklistEvent drops owner's claim on the event, so any instance may
+// publish it again.
+func (r *MySQLRepo) ReleaseBlacklistEvent(id uint, owner string) error {
+	err := r.db.Model(&models.BlacklistEvent{}).Where("id = ? AND claimed_by = ?", id, owner).
+		Update("claimed_until", nil).Error
+	if err != nil {
+		log.Printf("ReleaseBlacklistEvent: Failed to release event %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+func (r *MySQLRepo) MarkBlacklistEventPublished(id uint, at time.Time) error {
+	if err := r.db.Model(&models.BlacklistEvent{}).Where("id = ?", id).Update("published_at", at).Error; err != nil {
+		log.Printf("MarkBlacklistEventPublished: Failed to mark event %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+func (r *MySQLRepo) CreateSMSIndexBacklog(entries []models.SMSIndexBacklog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := r.db.Create(&entries).Error; err != nil {
+		log.Printf("CreateSMSIndexBacklog: Failed to store %d documents: %v", len(entries), err)
+		return err
+	}
+	return nil
+}
+
+// ListSMSIndexBacklog returns up to limit backlog documents, oldest first.
+func (r *MySQLRepo) ListSMSIndexBacklog(limit int) ([]models.SMSIndexBacklog, error) {
+	var entries []models.SMSIndexBacklog
+	if err := r.db.Order("id").Limit(limit).Find(&entries).Error; err != nil {
+		log.Printf("ListSMSIndexBacklog: Failed to list documents: %v", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *MySQLRepo) DeleteSMSIndexBacklog(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := r.db.Delete(&models.SMSIndexBacklog{}, ids).Error; err != nil {
+		log.Printf("DeleteSMSIndexBacklog: Failed to delete %d documents: %v", len(ids), err)
+		return err
+	}
+	return nil
+}
+
+// ListSMSAfter returns up to limit SMS with an ID after afterID, in ID order.
+func (r *MySQLRepo) ListSMSAfter(afterID string, limit int) ([]models.SMS, error) {
+	var smsList []models.SMS
+	if err := r.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&smsList).Error; err != nil {
+		log.Printf("ListSMSAfter: Failed to list SMS after %q: %v", afterID, err)
+		return nil, err
+	}
+	return smsList, nil
+}
+
+// ListSMSByIDs returns the SMS with the given IDs, of any tenant. IDs without
+// a row are left out.
+func (r *MySQLRepo) ListSMSByIDs(ids []string) ([]models.SMS, error) {
+	var smsList []models.SMS
+	if err := r.db.Where("id IN ?", ids).Find(&smsList).Error; err != nil {
+		log.Printf("ListSMSByIDs: Failed to list %d SMS: %v", len(ids), err)
+		return nil, err
+	}
+	return smsList, nil
+}
+
+// CountSMSAfter returns how many SMS have an ID after afterID.
+func (r *MySQLRepo) CountSMSAfter(afterID string) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.SMS{}).Where("id > ?", afterID).Count(&count).Error; err != nil {
+		log.Printf("CountSMSAfter: Failed to count SMS after %q: %v", afterID, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// DayCount is the number of SMS created on a day (yyyy-mm-dd).
+type DayCount struct {
+	Day   string
+	Count int64
+}
+
+// CountSMSByDay returns the number of SMS created on each day, oldest first.
+func (r *MySQLRepo) CountSMSByDay() ([]DayCount, error) {
+	var counts []DayCount
+	query := `SELECT DATE_FORMAT(created_at, '%Y-%m-%d') AS day, COUNT(*) AS count FROM sms GROUP BY day ORDER BY day`
+	if err := r.db.Raw(query).Scan(&counts).Error; err != nil {
+		log.Printf("CountSMSByDay: Failed to count SMS per day: %v", err)
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetBackfillCheckpoint returns the checkpoint of the target, or nil if it was
+// never backfilled.
+func (r *MySQLRepo) GetBackfillCheckpoint(target string) (*models.BackfillCheckpoint, error) {
+	var checkpoints []models.BackfillCheckpoint
+	if err := r.db.Where("target = ?", target).Limit(1).Find(&checkpoints).Error; err != nil {
+		log.Printf("GetBackfillCheckpoint: Failed to retrieve checkpoint of %s: %v", target, err)
+		return nil, err
+	}
+	if len(checkpoints) == 0 {
+		return nil, nil
+	}
+	return &checkpoints[0], nil
+}
+
+func (r *MySQLRepo) SaveBackfillCheckpoint(checkpoint *models.BackfillCheckpoint) error {
+	if err := r.db.Save(checkpoint).Error; err != nil {
+		log.Printf("SaveBackfillCheckpoint: Failed to save checkpoint of %s: %v", checkpoint.Target, err)
+		return err
+	}
+	return nil
+}
+
+// The schema is migrated once per process, however many services get the
+// repository
+var (
+	migrateOnce sync.Once
+	migrateErr  error
+)
+
 func GetMySqlRepository() (*MySQLRepo, error) {
 	// Initialize MySQL repository
 	mySQLRepo, err := NewMySQL(config.MySQLDSN)
@@ -74,8 +513,11 @@ func GetMySqlRepository() (*MySQLRepo, error) {
 	}
 
 	// Migrate DB
-	if err := mySQLRepo.Migrate(); err != nil {
-		return nil, err
+	migrateOnce.Do(func() {
+		migrateErr = mySQLRepo.Migrate()
+	})
+	if migrateErr != nil {
+		return nil, migrateErr
 	}
 	return mySQLRepo, nil
 }
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"log"
+	"time"
 	"notifications/configurations"
 	"github.com/go-redis/redis/v8"
 )
@@ -57,6 +58,160 @@ func (r *RedisRepo) SMembers(ctx context.Context, key string) *redis.StringSlice
 	log.Printf("SMembers: Retrieving all members from set '%s'", key)
 	return r.client.SMembers(ctx, key)
 }
+// SAddMany adds members to the set in batches of 1000 using a pipeline.
+func (r *RedisRepo) SAddMany(ctx context.Context, key string, members []string) error {
+	log.Printf("SAddMany: Adding %d members to set '%s'", len(members), key)
+	const batchSize = 1000
+	for start := 0; start < len(members); start += batchSize {
+		end := start + batchSize
+		if end > len(members) {
+			end = len(members)
+		}
+		pipe := r.client.Pipeline()
+		for _, member := range members[start:end] {
+			pipe.SAdd(ctx, key, member)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("SAddMany: Error adding members to set '%s': %v", key, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisRepo) ZAdd(ctx context.Context, key string, score float64, member string) *redis.IntCmd {
+	log.Printf("ZAdd: Adding member '%s' with score %v to sorted set '%s'", member, score, key)
+	return r.client.ZAdd(ctx, key, &redis.Z{Score: score, Member: member})
+}
+
+func (r *RedisRepo) ZRem(ctx context.Context, key, member string) *redis.IntCmd {
+	log.Printf("ZRem: Removing member '%s' from sorted set '%s'", member, key)
+	return r.client.ZRem(ctx, key, member)
+}
+
+func (r *RedisRepo) ZScore(ctx context.Context, key, member string) *redis.FloatCmd {
+	return r.client.ZScore(ctx, key, member)
+}
+
+func (r *RedisRepo) HSet(ctx context.Context, key string, values map[string]interface{}) *redis.IntCmd {
+	log.Printf("HSet: Setting %d fields in hash '%s'", len(values), key)
+	return r.client.HSet(ctx, key, values)
+}
+
+func (r *RedisRepo) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
+	return r.client.HMGet(ctx, key, fields...)
+}
+
+// SAddEach adds every member to the set in a single pipeline and reports, per
+// member, whether it was newly added.
+func (r *RedisRepo) SAddEach(ctx context.Context, key string, members []string) ([]bool, error) {
+	log.Printf("SAddEach: Adding %d members to set '%s'", len(members), key)
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(members))
+	for i, member := range members {
+		cmds[i] = pipe.SAdd(ctx, key, member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("SAddEach: Error adding members to set '%s': %v", key, err)
+		return nil, err
+	}
+	added := make([]bool, len(members))
+	for i, cmd := range cmds {
+		added[i] = cmd.Val() > 0
+	}
+	return added, nil
+}
+
+func (r *RedisRepo) SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd {
+	log.Printf("SScan: Scanning set '%s' from cursor %d", key, cursor)
+	return r.client.SScan(ctx, key, cursor, match, count)
+}
+
+func (r *RedisRepo) SCard(ctx context.Context, key string) *redis.IntCmd {
+	return r.client.SCard(ctx, key)
+}
+
+func (r *RedisRepo) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	log.Printf("Del: Deleting keys %v", keys)
+	return r.client.Del(ctx, keys...)
+}
+
+func (r *RedisRepo) Rename(ctx context.Context, key, newKey string) *redis.StatusCmd {
+	log.Printf("Rename: Renaming key '%s' to '%s'", key, newKey)
+	return r.client.Rename(ctx, key, newKey)
+}
+
+// RecordHit counts a hit on member in one pipeline: its score in the countKey
+// sorted set is incremented, its score in lastKey is set to the hit time and
+// the dailyKey counter is incremented and kept for dailyTTL.
+func (r *RedisRepo) RecordHit(ctx context.Context, member string, at time.Time, countKey, lastKey, dailyKey string, dailyTTL time.Duration) error {
+	pipe := r.client.Pipeline()
+	pipe.ZIncrBy(ctx, countKey, 1, member)
+	pipe.ZAdd(ctx, lastKey, &redis.Z{Score: float64(at.Unix()), Member: member})
+	pipe.Incr(ctx, dailyKey)
+	pipe.Expire(ctx, dailyKey, dailyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("RecordHit: Error recording hit for '%s': %v", member, err)
+		return err
+	}
+	return nil
+}
+
+// IncrWithTTL increments the counter at key and keeps it for ttl.
+func (r *RedisRepo) IncrWithTTL(ctx context.Context, key string, ttl time.Duration) error {
+	pipe := r.client.Pipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("IncrWithTTL: Error incrementing '%s': %v", key, err)
+		return err
+	}
+	return nil
+}
+
+// ZScores returns the score of each member of the sorted set, read in one
+// pipeline. Members that aren't in the set are left out.
+func (r *RedisRepo) ZScores(ctx context.Context, key string, members []string) (map[string]float64, error) {
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.FloatCmd, len(members))
+	for i, member := range members {
+		cmds[i] = pipe.ZScore(ctx, key, member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.Printf("ZScores: Error reading scores from sorted set '%s': %v", key, err)
+		return nil, err
+	}
+	scores := make(map[string]float64, len(members))
+	for i, cmd := range cmds {
+		if score, err := cmd.Result(); err == nil {
+			scores[members[i]] = score
+		}
+	}
+	return scores, nil
+}
+
+func (r *RedisRepo) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
+	return r.client.ZRevRangeWithScores(ctx, key, start, stop)
+}
+
+func (r *RedisRepo) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	return r.client.MGet(ctx, keys...)
+}
+
+// ScanKeys returns every key matching pattern, walking the keyspace with SCAN.
+func (r *RedisRepo) ScanKeys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("ScanKeys: Error scanning keys matching '%s': %v", pattern, err)
+		return nil, err
+	}
+	return keys, nil
+}
+
 func GetRedisRepository() (*RedisRepo,error) {
 	// Initialize MySQL repository
 	redisRepo:= NewRedisRepo(config.RedisAddr)
@@ -66,9 +221,5 @@ func GetRedisRepository() (*RedisRepo,error) {
 			return nil, err
 		}
 	
-		// Flush Redis database (optional, based on use case)
-		if err := redisRepo.FlushDB(ctx); err != nil {
-			return nil,err
-		}
 	return redisRepo ,nil
 }
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	repository "notifications/internal/pkg/repository"
+)
+
+// Constants for Redis keys
+const (
+	AllowlistKey = "Allow"
+)
+
+// allowlistKey returns the Redis set holding the tenant's allowlist.
+func allowlistKey(tenantID string) string {
+	return AllowlistKey + ":" + tenantID
+}
+
+// AllowlistService manages the numbers that may be texted while
+// config.AllowlistMode is on. The allowlist only lives in Redis; it is meant
+// for non-production environments and holds a handful of test numbers.
+type AllowlistService struct {
+	redisRepo *repository.RedisRepo
+}
+
+func GetAllowlistService() *AllowlistService {
+	redisrepo, err := repository.GetRedisRepository()
+	if err != nil {
+		log.Panic(err)
+	}
+	return &AllowlistService{redisRepo: redisrepo}
+}
+
+// AddToAllowlist adds phone numbers to the tenant's allowlist and returns the
+// numbers added and the ones that were already there, both normalized.
+// Nothing is added if any number is invalid.
+func (a *AllowlistService) AddToAllowlist(ctx context.Context, tenantID string, numbers []string) ([]string, []string, error) {
+	var added []string
+	var already []string
+
+	normalized := make([]string, 0, len(numbers))
+	seen := make(map[string]bool, len(numbers))
+	for _, number := range numbers {
+		number, err := NormalizePhoneNumber(number)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !seen[number] {
+			seen[number] = true
+			normalized = append(normalized, number)
+		}
+	}
+
+	for _, number := range normalized {
+		count, err := a.redisRepo.SAdd(ctx, allowlistKey(tenantID), number).Result()
+		if err != nil {
+			log.Printf("Error adding number %s to allowlist: %v", number, err)
+			return nil, nil, unavailable(fmt.Sprintf("error adding number %s to allowlist", number), err)
+		}
+		if count == 0 {
+			already = append(already, number)
+		} else {
+			added = append(added, number)
+		}
+	}
+	return added, already, nil
+}
+
+// RemoveFromAllowlist removes a phone number from the tenant's allowlist,
+// returning ErrNotFound if it wasn't there
+func (a *AllowlistService) RemoveFromAllowlist(ctx context.Context, tenantID string, number string) error {
+	number, err := NormalizePhoneNumber(number)
+	if err != nil {
+		return err
+	}
+	count, err := a.redisRepo.SRem(ctx, allowlistKey(tenantID), number).Result()
+	if err != nil {
+		log.Printf("Error removing number %s from allowlist: %v", number, err)
+		return unavailable(fmt.Sprintf("error removing number %s from allowlist", number), err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: number %s is not allowlisted", ErrNotFound, number)
+	}
+	return nil
+}
+
+// GetAllFromAllowlist retrieves all of the tenant's allowlisted phone numbers
+func (a *AllowlistService) GetAllFromAllowlist(ctx context.Context, tenantID string) ([]string, error) {
+	allowlist, err := a.redisRepo.SMembers(ctx, allowlistKey(tenantID)).Result()
+	if err != nil {
+		log.Printf("Error retrieving allowlisted numbers: %v", err)
+		return nil, unavailable("error retrieving allowlisted numbers", err)
+	}
+	return allowlist, nil
+}
+
+// IsNumberAllowlisted checks if a phone number is on the tenant's allowlist
+func (a *AllowlistService) IsNumberAllowlisted(ctx context.Context, tenantID string, number string) (bool, error) {
+	number, err := NormalizePhoneNumber(number)
+	if err != nil {
+		return false, err
+	}
+	return isAllowlistedInCache(ctx, a.redisRepo, tenantID, number)
+}
+
+// isAllowlistedInCache reports whether the number, in any format, is on the
+// tenant's allowlist.
+func isAllowlistedInCache(ctx context.Context, redisRepo *repository.RedisRepo, tenantID, number string) (bool, error) {
+	number = lookupPhoneNumber(number)
+	isAllowlisted, err := redisRepo.SIsMember(ctx, allowlistKey(tenantID), number).Result()
+	if err != nil {
+		log.Printf("Error checking allowlist status for number %s: %v", number, err)
+		return false, unavailable(fmt.Sprintf("error checking allowlist status for number %s", number), err)
+	}
+	return isAllowlisted, nil
+}
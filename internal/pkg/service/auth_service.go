@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	config "notifications/configurations"
+	"notifications/internal/models"
+	"notifications/internal/pkg/repository"
+)
+
+// API key scopes. Admin manages the key's own tenant; operator manages every
+// tenant and is only granted by another operator.
+const (
+	ScopeSMS      = "sms"
+	ScopeAdmin    = "admin"
+	ScopeOperator = "operator"
+)
+
+// Error Messages
+const (
+	ErrAuthenticate  = "failed to authenticate API key"
+	ErrCreateAPIKey  = "failed to create API key"
+	ErrEmptyClientID = "client ID cannot be empty"
+	ErrUnknownScope  = "unknown scope"
+)
+
+// Client ID owning the key registered from BootstrapAPIKeyEnv
+const bootstrapClientID = "bootstrap"
+
+// ClientIdentity is the authenticated caller of a request.
+type ClientIdentity struct {
+	ClientID string
+	TenantID string
+	Scopes   []string
+}
+
+// HasScope reports whether the client was granted scope. Operator implies
+// every other scope, admin every other but operator.
+func (c *ClientIdentity) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope || s == ScopeOperator || (s == ScopeAdmin && scope != ScopeOperator) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTenant returns ErrForbidden unless the client may act on tenantID: its
+// own tenant, or any tenant with the operator scope.
+func (c *ClientIdentity) CheckTenant(tenantID string) error {
+	if tenantID == c.TenantID || c.HasScope(ScopeOperator) {
+		return nil
+	}
+	return fmt.Errorf("%w: tenant %s requires the %s scope", ErrForbidden, tenantID, ScopeOperator)
+}
+
+type clientContextKey struct{}
+
+// ContextWithClient returns a copy of ctx carrying the client identity.
+func ContextWithClient(ctx context.Context, client *ClientIdentity) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, client)
+}
+
+// ClientFromContext returns the client identity stored in ctx, if any.
+func ClientFromContext(ctx context.Context) (*ClientIdentity, bool) {
+	client, ok := ctx.Value(clientContextKey{}).(*ClientIdentity)
+	return client, ok
+}
+
+// AuthService issues and verifies API keys. Only the SHA-256 hash of a key is
+// stored, so a key can't be recovered from the database.
+type AuthService struct {
+	db *repository.MySQLRepo
+}
+
+func GetAuthService() *AuthService {
+	sqlDb, err := repository.GetMySqlRepository()
+	if err != nil {
+		log.Panic(err)
+	}
+	service := &AuthService{db: sqlDb}
+	if err := service.registerBootstrapKey(); err != nil {
+		log.Panic(err)
+	}
+	return service
+}
+
+// Authenticate returns the identity owning rawKey, or nil if the key is
+// unknown or revoked.
+func (a *AuthService) Authenticate(rawKey string) (*ClientIdentity, error) {
+	if rawKey == "" {
+		return nil, nil
+	}
+	key, err := a.db.FindAPIKeyByHash(hashAPIKey(rawKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrAuthenticate, err)
+	}
+	if key == nil {
+		return nil, nil
+	}
+	return &ClientIdentity{ClientID: key.ClientID, TenantID: key.TenantID, Scopes: splitList(key.Scopes)}, nil
+}
+
+// CreateAPIKey issues a new key for clientID within tenantID and returns it.
+// The plain key is only ever available from this return value.
+func (a *AuthService) CreateAPIKey(clientID, tenantID string, scopes []string) (string, error) {
+	if clientID == "" {
+		return "", fmt.Errorf(ErrEmptyClientID)
+	}
+	if tenantID == "" {
+		tenantID = DefaultTenantID
+	}
+	for _, scope := range scopes {
+		if scope != ScopeSMS && scope != ScopeAdmin && scope != ScopeOperator {
+			return "", fmt.Errorf("%w: %s %q", ErrValidation, ErrUnknownScope, scope)
+		}
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("%s: %w", ErrCreateAPIKey, err)
+	}
+	rawKey := hex.EncodeToString(buf)
+	if err := a.storeAPIKey(clientID, tenantID, rawKey, scopes); err != nil {
+		return "", err
+	}
+	return rawKey, nil
+}
+
+func (a *AuthService) storeAPIKey(clientID, tenantID, rawKey string, scopes []string) error {
+	key := &models.APIKey{
+		ClientID: clientID,
+		TenantID: tenantID,
+		KeyHash:  hashAPIKey(rawKey),
+		Scopes:   strings.Join(scopes, ","),
+	}
+	if err := a.db.CreateAPIKey(key); err != nil {
+		return fmt.Errorf("%s: %w", ErrCreateAPIKey, err)
+	}
+	return nil
+}
+
+// registerBootstrapKey stores the admin key from BootstrapAPIKeyEnv if it is
+// set and not registered yet.
+func (a *AuthService) registerBootstrapKey() error {
+	rawKey := os.Getenv(config.BootstrapAPIKeyEnv)
+	if rawKey == "" {
+		return nil
+	}
+	existing, err := a.Authenticate(rawKey)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	log.Printf("registerBootstrapKey: Registering operator API key from %s", config.BootstrapAPIKeyEnv)
+	return a.storeAPIKey(bootstrapClientID, DefaultTenantID, rawKey, []string{ScopeOperator})
+}
+
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(list string) []string {
+	var result []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
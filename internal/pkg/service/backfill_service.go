@@ -0,0 +1,373 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	config "notifications/configurations"
+	"notifications/internal/models"
+	"notifications/internal/pkg/repository"
+)
+
+// Backfill job statuses
+const (
+	BackfillRunning   = "Running"
+	BackfillCompleted = "Completed"
+	BackfillFailed    = "Failed"
+)
+
+// BackfillRequest selects where a backfill indexes the SMS of MySQL. An empty
+// Target puts every SMS in the period index of its creation time, next to the
+// live documents. Resume continues after the target's checkpoint, and Compare
+// reports the days whose document counts differ from MySQL once done.
+type BackfillRequest struct {
+	Target  string `json:"target"`
+	Resume  bool   `json:"resume"`
+	Compare bool   `json:"compare"`
+}
+
+// DayCountGap is a day with a different number of SMS in MySQL and
+// Elasticsearch.
+type DayCountGap struct {
+	Day           string `json:"day"`
+	MySQL         int64  `json:"mysql"`
+	Elasticsearch int64  `json:"elasticsearch"`
+}
+
+// BackfillJob reports the progress of a backfill run. Total is the number of
+// SMS the run started with; LastID is the checkpoint it got to.
+type BackfillJob struct {
+	ID        string          `json:"jobID"`
+	Request   BackfillRequest `json:"request"`
+	Status    string          `json:"status"`
+	Total     int64           `json:"total"`
+	Processed int64           `json:"processed"`
+	Indexed   int64           `json:"indexed"`
+	Failed    int64           `json:"failed"`
+	LastID    string          `json:"lastID,omitempty"`
+	Gaps      []DayCountGap   `json:"gaps,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// BackfillService indexes the SMS of MySQL in Elasticsearch, to fill in
+// documents that were lost or never indexed.
+type BackfillService struct {
+	db *repository.MySQLRepo
+	es *repository.ElasticsearchRepo
+
+	mu      sync.Mutex
+	jobs    map[string]*BackfillJob
+	running map[string]string
+}
+
+// GetBackfillService returns the backfill service of the server. The MySQL
+// migration it shares with the other services only adds tables and columns,
+// so the SMS to backfill from are never dropped.
+func GetBackfillService() *BackfillService {
+	sqlDb, err := repository.GetMySqlRepository()
+	if err != nil {
+		log.Panic(err)
+	}
+	elasticRepo, err := repository.GetElasticRepo()
+	if err != nil {
+		log.Panic(err)
+	}
+	return newBackfillService(sqlDb, elasticRepo)
+}
+
+// OpenBackfillService returns a backfill service for the command line. Unlike
+// GetBackfillService it leaves the schema alone; the running server migrates
+// MySQL and prepares the Elasticsearch indices.
+func OpenBackfillService() (*BackfillService, error) {
+	sqlDb, err := repository.NewMySQL(config.MySQLDSN)
+	if err != nil {
+		return nil, err
+	}
+	elasticRepo, err := repository.NewElasticSearch(config.ElasticsearchAddr)
+	if err != nil {
+		return nil, err
+	}
+	return newBackfillService(sqlDb, elasticRepo), nil
+}
+
+func newBackfillService(db *repository.MySQLRepo, es *repository.ElasticsearchRepo) *BackfillService {
+	return &BackfillService{
+		db:      db,
+		es:      es,
+		jobs:    make(map[string]*BackfillJob),
+		running: make(map[string]string),
+	}
+}
+
+// checkpointTarget names the checkpoint of a backfill target.
+func checkpointTarget(target string) string {
+	if target == "" {
+		return config.ElasticsearchSMSAlias
+	}
+	return target
+}
+
+// StartBackfill creates a backfill job and runs it in the background. The
+// returned job is a snapshot; poll GetBackfillJob for progress.
+func (s *BackfillService) StartBackfill(request BackfillRequest) (BackfillJob, error) {
+	job, err := s.newJob(request)
+	if err != nil {
+		return BackfillJob{}, err
+	}
+	go s.run(job.ID, nil)
+	log.Printf("StartBackfill: Started backfill job %s", job.ID)
+	return job, nil
+}
+
+// RunBackfill runs a backfill job to the end, calling progress after every
+// batch.
+func (s *BackfillService) RunBackfill(request BackfillRequest, progress func(job BackfillJob)) (BackfillJob, error) {
+	job, err := s.newJob(request)
+	if err != nil {
+		return BackfillJob{}, err
+	}
+	s.run(job.ID, progress)
+	job, _ = s.GetBackfillJob(job.ID)
+	if job.Status == BackfillFailed {
+		return job, errors.New(job.Error)
+	}
+	return job, nil
+}
+
+// GetBackfillJob returns the current state of a backfill job, or ErrNotFound.
+func (s *BackfillService) GetBackfillJob(id string) (BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return BackfillJob{}, fmt.Errorf("%w: backfill job %s", ErrNotFound, id)
+	}
+	return *job, nil
+}
+
+// newJob registers a job, refusing a second concurrent run on one target.
+func (s *BackfillService) newJob(request BackfillRequest) (BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target := checkpointTarget(request.Target)
+	if id, ok := s.running[target]; ok {
+		return BackfillJob{}, fmt.Errorf("%w: backfill job %s is already running for %s", ErrAlreadyExists, id, target)
+	}
+	now := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+	job := &BackfillJob{
+		ID:        fmt.Sprintf("backfill-%d", time.Now().UnixNano()),
+		Request:   request,
+		Status:    BackfillRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.jobs[job.ID] = job
+	s.running[target] = job.ID
+	return *job, nil
+}
+
+func (s *BackfillService) update(id string, fn func(job *BackfillJob)) BackfillJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	fn(job)
+	job.UpdatedAt = time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+	if job.Status != BackfillRunning {
+		delete(s.running, checkpointTarget(job.Request.Target))
+	}
+	return *job
+}
+
+func (s *BackfillService) fail(id string, err error) {
+	log.Printf("runBackfill: %s: %v", id, err)
+	s.update(id, func(job *BackfillJob) {
+		job.Status = BackfillFailed
+		job.Error = err.Error()
+	})
+}
+
+// run streams the SMS from MySQL in ID order and bulk indexes them, saving the
+// checkpoint after every batch. A failed run can be resumed from there.
+func (s *BackfillService) run(id string, progress func(job BackfillJob)) {
+	job, _ := s.GetBackfillJob(id)
+	request := job.Request
+	target := checkpointTarget(request.Target)
+
+	afterID := ""
+	if request.Resume {
+		checkpoint, err := s.db.GetBackfillCheckpoint(target)
+		if err != nil {
+			s.fail(id, fmt.Errorf("failed to read checkpoint: %w", err))
+			return
+		}
+		if checkpoint != nil {
+			afterID = checkpoint.LastID
+			log.Printf("runBackfill: %s: Resuming %s after %s", id, target, afterID)
+		}
+	}
+	total, err := s.db.CountSMSAfter(afterID)
+	if err != nil {
+		s.fail(id, fmt.Errorf("failed to count SMS: %w", err))
+		return
+	}
+	s.update(id, func(job *BackfillJob) {
+		job.Total = total
+		job.LastID = afterID
+	})
+
+	for {
+		smsList, err := s.db.ListSMSAfter(afterID, config.ElasticsearchBulkSize)
+		if err != nil {
+			s.fail(id, fmt.Errorf("failed to read SMS after %q: %w", afterID, err))
+			return
+		}
+		if len(smsList) == 0 {
+			break
+		}
+
+		failed, err := s.indexBatch(request.Target, smsList)
+		if err != nil {
+			s.fail(id, fmt.Errorf("failed to index SMS after %q: %w", afterID, err))
+			return
+		}
+		afterID = smsList[len(smsList)-1].ID
+		if err := s.db.SaveBackfillCheckpoint(&models.BackfillCheckpoint{Target: target, LastID: afterID}); err != nil {
+			s.fail(id, fmt.Errorf("failed to save checkpoint: %w", err))
+			return
+		}
+
+		snapshot := s.update(id, func(job *BackfillJob) {
+			job.Processed += int64(len(smsList))
+			job.Indexed += int64(len(smsList) - failed)
+			job.Failed += int64(failed)
+			job.LastID = afterID
+		})
+		if progress != nil {
+			progress(snapshot)
+		}
+	}
+
+	var gaps []DayCountGap
+	if request.Compare {
+		if gaps, err = s.compareDayCounts(request.Target); err != nil {
+			s.fail(id, fmt.Errorf("failed to compare counts: %w", err))
+			return
+		}
+	}
+	snapshot := s.update(id, func(job *BackfillJob) {
+		job.Gaps = gaps
+		job.Status = BackfillCompleted
+	})
+	if progress != nil {
+		progress(snapshot)
+	}
+	log.Printf("runBackfill: Backfill job %s completed, %d of %d SMS indexed", id, snapshot.Indexed, snapshot.Total)
+}
+
+// indexBatch bulk indexes the SMS, retrying failures with exponential backoff.
+// It returns how many SMS could not be indexed after the retries, or an error
+// if Elasticsearch kept rejecting the whole batch.
+func (s *BackfillService) indexBatch(target string, smsList []models.SMS) (int, error) {
+	docs := make([]repository.SMSDocument, 0, len(smsList))
+	for _, sms := range smsList {
+		doc, err := repository.NewSMSDocument(sms, sms.CreatedAt, sms.UpdatedAt)
+		if err != nil {
+			log.Printf("indexBatch: %s for %s: %v", ErrIndexElasticsearch, sms.ID, err)
+			continue
+		}
+		if target != "" {
+			doc.Index = target
+		}
+		docs = append(docs, doc)
+	}
+	skipped := len(smsList) - len(docs)
+
+	backoff := config.ElasticsearchRetryBackoff
+	for attempt := 1; ; attempt++ {
+		failed, err := s.es.BulkIndexSMS(docs)
+		if err == nil {
+			docs = failed
+		}
+		if len(docs) == 0 || attempt >= config.ElasticsearchRetryAttempts {
+			if err != nil {
+				return 0, err
+			}
+			return skipped + len(docs), nil
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// compareDayCounts returns the days whose number of SMS in MySQL and in the
+// target differ, oldest first.
+func (s *BackfillService) compareDayCounts(target string) ([]DayCountGap, error) {
+	index := target
+	if index == "" {
+		index = config.ElasticsearchSMSAlias
+	}
+	// Bulk requests don't refresh, so make the backfilled documents countable
+	if err := s.es.Refresh(index); err != nil {
+		return nil, err
+	}
+
+	mysqlCounts, err := s.db.CountSMSByDay()
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Aggregations struct {
+			PerDay struct {
+				Buckets []struct {
+					KeyAsString string `json:"key_as_string"`
+					DocCount    int64  `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"per_day"`
+		} `json:"aggregations"`
+	}
+	request := map[string]interface{}{
+		"aggs": map[string]interface{}{
+			"per_day": map[string]interface{}{
+				"date_histogram": map[string]interface{}{
+					"field":             "created_at",
+					"calendar_interval": IntervalDay,
+					"format":            "yyyy-MM-dd",
+					"min_doc_count":     1,
+				},
+			},
+		},
+	}
+	if err := s.es.Aggregate(index, request, &response); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]*DayCountGap)
+	day := func(d string) *DayCountGap {
+		if counts[d] == nil {
+			counts[d] = &DayCountGap{Day: d}
+		}
+		return counts[d]
+	}
+	for _, count := range mysqlCounts {
+		day(count.Day).MySQL = count.Count
+	}
+	for _, bucket := range response.Aggregations.PerDay.Buckets {
+		day(bucket.KeyAsString).Elasticsearch = bucket.DocCount
+	}
+
+	var gaps []DayCountGap
+	for _, count := range counts {
+		if count.MySQL != count.Elasticsearch {
+			gaps = append(gaps, *count)
+		}
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].Day < gaps[j].Day })
+	return gaps, nil
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	config "notifications/configurations"
+	msg "notifications/internal/kafka"
+	"notifications/internal/models"
+	"notifications/internal/pkg/repository"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Blacklist event types
+const (
+	EventBlacklistAdded   = "blacklist.added"
+	EventBlacklistRemoved = "blacklist.removed"
+)
+
+const (
+	// How often the outbox is polled for unpublished events
+	blacklistEventRelayInterval = 2 * time.Second
+	// Events read from the outbox per poll
+	blacklistEventBatchSize = 500
+)
+
+// BlacklistEventPublisher relays blacklist events from the MySQL outbox to
+// Kafka. An event is only marked published once Kafka confirms delivery, so
+// events are delivered at least once; consumers should dedupe on event_id.
+// Events of one tenant and number are published one at a time, in outbox
+// order, so a failed event is retried before any later event of its number.
+// Every instance runs a publisher; an instance claims the events it produces
+// for BlacklistEventClaimLease, so the others leave them and the later events
+// of their number alone.
+type BlacklistEventPublisher struct {
+	db       *repository.MySQLRepo
+	producer *kafka.Producer
+	// owner identifies this instance in the claims
+	owner  string
+	closed atomic.Bool
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu sync.Mutex
+	// inFlight holds the ID of the event awaiting delivery per message key
+	inFlight map[string]uint
+}
+
+func newBlacklistEventPublisher(db *repository.MySQLRepo) *BlacklistEventPublisher {
+	producer, err := msg.GetKafkaProducer()
+	if err != nil {
+		log.Panic(err)
+	}
+	p := &BlacklistEventPublisher{
+		db:       db,
+		producer: producer,
+		owner:    blacklistEventOwner(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		inFlight: make(map[string]uint),
+	}
+	go msg.HandleDeliveryReports(producer, p.handleDeliveryReport)
+	go p.relay()
+	return p
+}
+
+// relay publishes pending outbox events until the publisher is closed.
+func (p *BlacklistEventPublisher) relay() {
+	defer close(p.done)
+	ticker := time.NewTicker(blacklistEventRelayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.publishPending()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// publishPending claims and produces the oldest pending event of every key
+// that has no event in flight here or claimed by another instance. Later
+// events of a key wait for the next poll, after the delivery report of the
+// earlier one.
+func (p *BlacklistEventPublisher) publishPending() {
+	var claimed []models.BlacklistEvent
+	err := p.db.Transaction(func(tx *repository.MySQLRepo) error {
+		events, err := tx.LockPendingBlacklistEvents(blacklistEventBatchSize)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		claimed = p.claimable(events, now)
+		ids := make([]uint, len(claimed))
+		for n, event := range claimed {
+			ids[n] = event.ID
+		}
+		return tx.ClaimBlacklistEvents(ids, p.owner, now.Add(config.BlacklistEventClaimLease))
+	})
+	if err != nil {
+		log.Printf("publishPending: Failed to claim blacklist events: %v", err)
+		for _, event := range claimed {
+			p.clearInFlight(blacklistEventKey(event))
+		}
+		return
+	}
+
+	topic := config.KafkaBlacklistEventsTopic
+	for _, event := range claimed {
+		key := blacklistEventKey(event)
+		value, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("publishPending: Failed to encode blacklist event %d: %v", event.ID, err)
+			p.release(key, event.ID)
+			continue
+		}
+		err = p.producer.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+			Key:            []byte(key),
+			Value:          value,
+			Headers:        []kafka.Header{{Key: "event_type", Value: []byte(event.Type)}},
+			Opaque:         event.ID,
+		}, nil)
+		if err != nil {
+			log.Printf("publishPending: Failed to produce blacklist event %d: %v", event.ID, err)
+			p.release(key, event.ID)
+		}
+	}
+}
+
+// claimable returns the oldest event of every key among events, which are in
+// outbox order, unless the key has an event in flight here or its oldest
+// event is claimed by another instance. The returned events are marked in
+// flight.
+func (p *BlacklistEventPublisher) claimable(events []models.BlacklistEvent, now time.Time) []models.BlacklistEvent {
+	var claimable []models.BlacklistEvent
+	seen := make(map[string]bool)
+	for _, event := range events {
+		key := blacklistEventKey(event)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if event.ClaimedBy != p.owner && event.ClaimedUntil != nil && event.ClaimedUntil.After(now) {
+			continue
+		}
+		if !p.markInFlight(key, event.ID) {
+			continue
+		}
+		claimable = append(claimable, event)
+	}
+	return claimable
+}
+
+// release drops the claim on an event that was not delivered, so that this
+// or another instance retries it on its next poll.
+func (p *BlacklistEventPublisher) release(key string, id uint) {
+	p.clearInFlight(key)
+	if err := p.db.ReleaseBlacklistEvent(id, p.owner); err != nil {
+		log.Printf("release: Blacklist event %d stays claimed until its lease runs out: %v", id, err)
+	}
+}
+
+// handleDeliveryReport marks delivered events as published. Failed ones are
+// left pending and picked up again by the next poll, ahead of the later
+// events of their key.
+func (p *BlacklistEventPublisher) handleDeliveryReport(m *msg.Message) {
+	id, _ := m.Opaque.(uint)
+	if m.TopicPartition.Error != nil {
+		log.Printf("handleDeliveryReport: Blacklist event %d not delivered, will retry: %v", id, m.TopicPartition.Error)
+		p.release(string(m.Key), id)
+		return
+	}
+	defer p.clearInFlight(string(m.Key))
+
+	if err := p.db.MarkBlacklistEventPublished(id, time.Now().UTC()); err != nil {
+		log.Printf("handleDeliveryReport: Blacklist event %d delivered but not marked published: %v", id, err)
+	}
+}
+
+// markInFlight records id as the key's event in flight, unless the key already
+// has one.
+func (p *BlacklistEventPublisher) markInFlight(key string, id uint) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.inFlight[key]; ok {
+		return false
+	}
+	p.inFlight[key] = id
+	return true
+}
+
+func (p *BlacklistEventPublisher) clearInFlight(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.inFlight, key)
+}
+
+// Close stops the relay, waits for a poll in progress and flushes events
+// already handed to the producer. Events still in the outbox are published
+// by another instance, or after the next start; those claimed here once their
+// lease runs out.
+func (p *BlacklistEventPublisher) Close() {
+	if !p.closed.CompareAndSwap(false, true) {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	if remaining := p.producer.Flush(config.KafkaFlushTimeoutMs); remaining > 0 {
+		log.Printf("Close: %d blacklist events were not delivered before the flush timeout", remaining)
+	}
+	p.producer.Close()
+}
+
+// blacklistEventOwner identifies this process in the claims of the events it
+// relays.
+func blacklistEventOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// blacklistEventKey returns the Kafka key of an event: its tenant and number.
+func blacklistEventKey(event models.BlacklistEvent) string {
+	return event.TenantID + ":" + event.PhoneNumber
+}
+
+// blacklistEvent builds the outbox row for a change to a blacklist entry.
+func blacklistEvent(eventType string, entry models.BlacklistEntry, actor string) models.BlacklistEvent {
+	return models.BlacklistEvent{
+		Type:        eventType,
+		TenantID:    entry.TenantID,
+		PhoneNumber: entry.PhoneNumber,
+		Reason:      entry.Reason,
+		Actor:       actor,
+	}
+}
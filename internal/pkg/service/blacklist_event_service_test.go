@@ -0,0 +1,52 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"notifications/internal/models"
+)
+
+func TestClaimableEvents(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+	earlier := now.Add(-time.Minute)
+
+	p := &BlacklistEventPublisher{owner: "host-a:1", inFlight: map[string]uint{"t1:+910000000005": 50}}
+	events := []models.BlacklistEvent{
+		// Oldest event of its key: claimed
+		{ID: 1, TenantID: "t1", PhoneNumber: "+910000000001"},
+		// Later event of the same key waits for the first
+		{ID: 2, TenantID: "t1", PhoneNumber: "+910000000001"},
+		// Claimed by another instance: the key is left alone
+		{ID: 3, TenantID: "t1", PhoneNumber: "+910000000002", ClaimedBy: "host-b:1", ClaimedUntil: &later},
+		{ID: 4, TenantID: "t1", PhoneNumber: "+910000000002"},
+		// Lease of another instance ran out: taken over
+		{ID: 5, TenantID: "t1", PhoneNumber: "+910000000003", ClaimedBy: "host-b:1", ClaimedUntil: &earlier},
+		// Still claimed by this instance, but no longer in flight: claimed again
+		{ID: 6, TenantID: "t1", PhoneNumber: "+910000000004", ClaimedBy: "host-a:1", ClaimedUntil: &later},
+		// In flight here
+		{ID: 7, TenantID: "t1", PhoneNumber: "+910000000005"},
+		// Same number, other tenant
+		{ID: 8, TenantID: "t2", PhoneNumber: "+910000000001"},
+	}
+
+	var got []uint
+	for _, event := range p.claimable(events, now) {
+		got = append(got, event.ID)
+	}
+
+	if want := []uint{1, 5, 6, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("claimed events %v, want %v", got, want)
+	}
+	for _, id := range []uint{1, 5, 6, 8} {
+		key := blacklistEventKey(events[id-1])
+		if p.inFlight[key] != id {
+			t.Errorf("event %d not marked in flight: %v", id, p.inFlight)
+		}
+	}
+	if p.inFlight["t1:+910000000005"] != 50 {
+		t.Errorf("event in flight replaced: %v", p.inFlight)
+	}
+}
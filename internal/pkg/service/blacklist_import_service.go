@@ -0,0 +1,301 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"notifications/internal/models"
+	"notifications/internal/pkg/repository"
+)
+
+// Bulk import and export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+const (
+	// Numbers written to MySQL and Redis per batch during an import
+	importBatchSize = 1000
+	// At most this many invalid lines are listed in an import report
+	maxReportedInvalidLines = 1000
+	// Longest NDJSON line an import reads
+	maxImportLineSize = 1024 * 1024
+)
+
+// InvalidImportLine is a line of an import that was skipped.
+type InvalidImportLine struct {
+	Line  int    `json:"line"`
+	Value string `json:"value"`
+	Error string `json:"error"`
+}
+
+// BlacklistImportReport summarises a bulk import. Invalid lists the first
+// maxReportedInvalidLines bad lines; InvalidCount counts all of them.
+type BlacklistImportReport struct {
+	Added        int                 `json:"added"`
+	Already      int                 `json:"already_present"`
+	InvalidCount int                 `json:"invalid_count"`
+	Invalid      []InvalidImportLine `json:"invalid"`
+}
+
+func (r *BlacklistImportReport) addInvalid(line int, value string, err error) {
+	r.InvalidCount++
+	if len(r.Invalid) < maxReportedInvalidLines {
+		r.Invalid = append(r.Invalid, InvalidImportLine{Line: line, Value: value, Error: err.Error()})
+	}
+}
+
+// importRecord is one line of an import: a number and an optional reason, or
+// the error that made the line unreadable.
+type importRecord struct {
+	Number string `json:"number"`
+	Reason string `json:"reason"`
+	err    error
+}
+
+// ImportBlacklist streams CSV (number[,reason] per row, optional header) or
+// NDJSON ({"number": ..., "reason": ...} per line) from body, normalizes every
+// number and adds the valid ones in batches. metadata supplies the source,
+// actor and default reason for every line.
+func (b *BlacklistService) ImportBlacklist(ctx context.Context, tenantID string, body io.Reader, format string, metadata BlacklistMetadata) (*BlacklistImportReport, error) {
+	if err := metadata.Validate(); err != nil {
+		return nil, err
+	}
+	report := &BlacklistImportReport{Invalid: []InvalidImportLine{}}
+	var batch []models.BlacklistEntry
+
+	handle := func(line int, record importRecord) error {
+		if record.err != nil {
+			report.addInvalid(line, record.Number, record.err)
+			return nil
+		}
+		number, err := NormalizePhoneNumber(record.Number)
+		if err != nil {
+			report.addInvalid(line, record.Number, err)
+			return nil
+		}
+		lineMetadata := metadata
+		if record.Reason != "" {
+			lineMetadata.Reason = record.Reason
+			if err := lineMetadata.Validate(); err != nil {
+				report.addInvalid(line, record.Number, err)
+				return nil
+			}
+		}
+		batch = append(batch, models.BlacklistEntry{
+			TenantID:    tenantID,
+			PhoneNumber: number,
+			Reason:      lineMetadata.Reason,
+			Source:      lineMetadata.Source,
+			AddedBy:     lineMetadata.AddedBy,
+			ExpiresAt:   lineMetadata.ExpiresAt,
+		})
+		if len(batch) >= importBatchSize {
+			if err := b.importBatch(ctx, tenantID, batch, report); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		return nil
+	}
+
+	var err error
+	switch format {
+	case FormatCSV:
+		err = readCSVRecords(body, handle)
+	case FormatNDJSON:
+		err = readNDJSONRecords(body, handle)
+	default:
+		return nil, fmt.Errorf("%w: unsupported import format %q", ErrValidation, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := b.importBatch(ctx, tenantID, batch, report); err != nil {
+		return nil, err
+	}
+
+	log.Printf("ImportBlacklist: Tenant %s imported %d numbers, %d already present, %d invalid",
+		tenantID, report.Added, report.Already, report.InvalidCount)
+	return report, nil
+}
+
+// importBatch writes a batch to MySQL first, as the source of truth, then to
+// the Redis set in one pipeline, counting which numbers were new. A number
+// repeated in the batch is stored once, with the metadata of its last line,
+// and its repeats count as already present.
+func (b *BlacklistService) importBatch(ctx context.Context, tenantID string, batch []models.BlacklistEntry, report *BlacklistImportReport) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	batch = dedupeBatch(batch, report)
+	numbers := make([]string, len(batch))
+	for i, entry := range batch {
+		numbers[i] = entry.PhoneNumber
+	}
+	err := b.db.Transaction(func(tx *repository.MySQLRepo) error {
+		existing, err := tx.FindBlacklistedNumbers(tenantID, numbers)
+		if err != nil {
+			return err
+		}
+		listed := make(map[string]bool, len(existing))
+		for _, number := range existing {
+			listed[number] = true
+		}
+		if err := tx.InsertBlacklistEntries(batch); err != nil {
+			return err
+		}
+		var events []models.BlacklistEvent
+		for _, entry := range batch {
+			if !listed[entry.PhoneNumber] {
+				events = append(events, blacklistEvent(EventBlacklistAdded, entry, entry.AddedBy))
+			}
+		}
+		return tx.CreateBlacklistEvents(events)
+	})
+	if err != nil {
+		return fmt.Errorf("error importing blacklist batch: %w", err)
+	}
+
+	for _, entry := range batch {
+		var err error
+		if entry.ExpiresAt != nil {
+			err = b.redisRepo.ZAdd(ctx, blacklistExpiryKey(tenantID), float64(entry.ExpiresAt.Unix()), entry.PhoneNumber).Err()
+		} else {
+			err = b.redisRepo.ZRem(ctx, blacklistExpiryKey(tenantID), entry.PhoneNumber).Err()
+		}
+		if err != nil {
+			return fmt.Errorf("error importing blacklist batch: %w", err)
+		}
+	}
+	added, err := b.redisRepo.SAddEach(ctx, blacklistKey(tenantID), numbers)
+	if err != nil {
+		return fmt.Errorf("error importing blacklist batch: %w", err)
+	}
+	for _, isNew := range added {
+		if isNew {
+			report.Added++
+		} else {
+			report.Already++
+		}
+	}
+	return nil
+}
+
+// dedupeBatch keeps one entry per number, with the metadata of its last line,
+// in the order the numbers first appear.
+func dedupeBatch(batch []models.BlacklistEntry, report *BlacklistImportReport) []models.BlacklistEntry {
+	positions := make(map[string]int, len(batch))
+	unique := make([]models.BlacklistEntry, 0, len(batch))
+	for _, entry := range batch {
+		if i, ok := positions[entry.PhoneNumber]; ok {
+			unique[i] = entry
+			report.Already++
+			continue
+		}
+		positions[entry.PhoneNumber] = len(unique)
+		unique = append(unique, entry)
+	}
+	return unique
+}
+
+func readCSVRecords(body io.Reader, handle func(line int, record importRecord) error) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	for first := true; ; first = false {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				if err := handle(parseErr.StartLine, importRecord{err: parseErr.Err}); err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("error reading CSV import: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(row) == 0 || (first && strings.EqualFold(strings.TrimSpace(row[0]), "number")) {
+			continue
+		}
+		record := importRecord{Number: row[0]}
+		if len(row) > 1 {
+			record.Reason = strings.TrimSpace(row[1])
+		}
+		if err := handle(line, record); err != nil {
+			return err
+		}
+	}
+}
+
+func readNDJSONRecords(body io.Reader, handle func(line int, record importRecord) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxImportLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record importRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			record = importRecord{Number: text, err: err}
+		}
+		if err := handle(line, record); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading NDJSON import: %w", err)
+	}
+	return nil
+}
+
+// ExportBlacklist writes the tenant's whole blacklist to w as CSV or NDJSON,
+// streaming it from MySQL.
+func (b *BlacklistService) ExportBlacklist(tenantID string, format string, w io.Writer) error {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"number", "reason", "source", "added_by", "added_at", "expires_at"}); err != nil {
+			return err
+		}
+		err := b.db.StreamBlacklistEntries(tenantID, func(entry models.BlacklistEntry) error {
+			expiresAt := ""
+			if entry.ExpiresAt != nil {
+				expiresAt = entry.ExpiresAt.Format(time.RFC3339)
+			}
+			return writer.Write([]string{entry.PhoneNumber, entry.Reason, entry.Source, entry.AddedBy, entry.CreatedAt.Format(time.RFC3339), expiresAt})
+		})
+		writer.Flush()
+		if err != nil {
+			return fmt.Errorf("error exporting blacklist: %w", err)
+		}
+		return writer.Error()
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		err := b.db.StreamBlacklistEntries(tenantID, func(entry models.BlacklistEntry) error {
+			return encoder.Encode(entry)
+		})
+		if err != nil {
+			return fmt.Errorf("error exporting blacklist: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported export format %q", ErrValidation, format)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"notifications/internal/models"
+)
+
+func TestDedupeBatchKeepsLastMetadata(t *testing.T) {
+	batch := []models.BlacklistEntry{
+		{PhoneNumber: "+919876543210", Reason: "first"},
+		{PhoneNumber: "+919876543211", Reason: "other"},
+		{PhoneNumber: "+919876543210", Reason: "second"},
+		{PhoneNumber: "+919876543210", Reason: "last"},
+	}
+	report := &BlacklistImportReport{}
+
+	unique := dedupeBatch(batch, report)
+
+	if len(unique) != 2 {
+		t.Fatalf("dedupeBatch kept %d entries, want 2: %+v", len(unique), unique)
+	}
+	if unique[0].PhoneNumber != "+919876543210" || unique[0].Reason != "last" {
+		t.Errorf("first entry = %+v, want +919876543210 with the last reason", unique[0])
+	}
+	if unique[1].PhoneNumber != "+919876543211" {
+		t.Errorf("second entry = %+v, want +919876543211", unique[1])
+	}
+	if report.Already != 2 {
+		t.Errorf("Already = %d, want 2 for the repeats", report.Already)
+	}
+}
+
+func TestReadNDJSONRecordsLongLine(t *testing.T) {
+	reason := strings.Repeat("r", 100*1024)
+	body := fmt.Sprintf("{\"number\":\"+919876543210\",\"reason\":%q}\n{\"number\":\"+919876543211\"}\n", reason)
+
+	var records []importRecord
+	err := readNDJSONRecords(strings.NewReader(body), func(line int, record importRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readNDJSONRecords: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("read %d records, want 2", len(records))
+	}
+	if records[0].err != nil || records[0].Reason != reason {
+		t.Errorf("long line read as %q, %v", records[0].Number, records[0].err)
+	}
+}
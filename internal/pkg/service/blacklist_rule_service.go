@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"notifications/internal/models"
+	repository "notifications/internal/pkg/repository"
+)
+
+// Redis hash mapping every prefix a tenant's rules cover to the rule's ID
+const BlacklistRuleKey = "BlackRule"
+
+// Blacklist rule types
+const (
+	RuleTypePrefix = "prefix"
+	RuleTypeRange  = "range"
+)
+
+// Error Messages
+const (
+	ErrInvalidBlacklistRule = "invalid blacklist rule"
+)
+
+func blacklistRuleKey(tenantID string) string {
+	return BlacklistRuleKey + ":" + tenantID
+}
+
+// BlacklistRuleInput is a rule as submitted by a caller. A rule is either a
+// prefix ("+92"), an explicit range (Start and End of the same length) or a
+// pattern whose trailing x's stand for any digit ("+9190000xxxxx"), which is
+// stored as the equivalent range.
+type BlacklistRuleInput struct {
+	Type    string `json:"type"`
+	Prefix  string `json:"prefix"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	Pattern string `json:"pattern"`
+	Reason  string `json:"reason"`
+}
+
+// ToRule validates the input and converts it to a rule for the tenant.
+func (in BlacklistRuleInput) ToRule(tenantID, addedBy string) (*models.BlacklistRule, error) {
+	metadata := BlacklistMetadata{Reason: in.Reason}
+	if err := metadata.Validate(); err != nil {
+		return nil, err
+	}
+	rule := &models.BlacklistRule{TenantID: tenantID, Reason: metadata.Reason, AddedBy: addedBy}
+
+	if in.Pattern != "" {
+		trimmed := strings.TrimRight(strings.ToLower(in.Pattern), "x")
+		wildcards := len(in.Pattern) - len(trimmed)
+		if wildcards == 0 {
+			in.Type, in.Prefix = RuleTypePrefix, trimmed
+		} else {
+			in.Type = RuleTypeRange
+			in.Start = trimmed + strings.Repeat("0", wildcards)
+			in.End = trimmed + strings.Repeat("9", wildcards)
+		}
+	}
+
+	switch in.Type {
+	case RuleTypePrefix:
+		if !isDigits(ruleDigits(in.Prefix)) {
+			return nil, fmt.Errorf("%w: %s: prefix %q must be digits with an optional leading '+'", ErrValidation, ErrInvalidBlacklistRule, in.Prefix)
+		}
+		rule.Type, rule.Prefix = RuleTypePrefix, in.Prefix
+	case RuleTypeRange:
+		start, err := NormalizePhoneNumber(in.Start)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ErrInvalidBlacklistRule, err)
+		}
+		end, err := NormalizePhoneNumber(in.End)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ErrInvalidBlacklistRule, err)
+		}
+		if len(ruleDigits(start)) != len(ruleDigits(end)) || ruleDigits(start) > ruleDigits(end) {
+			return nil, fmt.Errorf("%w: %s: range %s-%s must have ends of the same length in order", ErrValidation, ErrInvalidBlacklistRule, start, end)
+		}
+		rule.Type, rule.RangeStart, rule.RangeEnd = RuleTypeRange, start, end
+	default:
+		return nil, fmt.Errorf("%w: %s: unknown type %q", ErrValidation, ErrInvalidBlacklistRule, in.Type)
+	}
+	return rule, nil
+}
+
+// ruleDigits returns the form rules and numbers are compared in: the digits
+// without the optional leading '+', so that "+92" and "92" cover the same
+// numbers.
+func ruleDigits(s string) string {
+	return strings.TrimPrefix(s, "+")
+}
+
+// ruleFields returns the hash fields a rule is stored under. Prefix rules use
+// the bare prefix. Range rules are split into the smallest set of prefixes
+// covering the range, each suffixed with "#<digits>" so that they only match
+// numbers with as many digits as the range ends.
+func ruleFields(rule models.BlacklistRule) []string {
+	if rule.Type == RuleTypePrefix {
+		return []string{ruleDigits(rule.Prefix)}
+	}
+	start := ruleDigits(rule.RangeStart)
+	end := ruleDigits(rule.RangeEnd)
+	suffix := "#" + strconv.Itoa(len(start))
+
+	var fields []string
+	for _, prefix := range rangePrefixes(start, end) {
+		fields = append(fields, prefix+suffix)
+	}
+	return fields
+}
+
+// rangePrefixes returns the prefixes that together cover exactly the digit
+// strings between lo and hi, which must have the same length.
+func rangePrefixes(lo, hi string) []string {
+	if strings.Trim(lo, "0") == "" && strings.Trim(hi, "9") == "" {
+		return []string{""}
+	}
+	if lo[0] == hi[0] {
+		var result []string
+		for _, p := range rangePrefixes(lo[1:], hi[1:]) {
+			result = append(result, lo[:1]+p)
+		}
+		return result
+	}
+
+	rest := len(lo) - 1
+	var result []string
+	for _, p := range rangePrefixes(lo[1:], strings.Repeat("9", rest)) {
+		result = append(result, lo[:1]+p)
+	}
+	for d := lo[0] + 1; d < hi[0]; d++ {
+		result = append(result, string(d))
+	}
+	for _, p := range rangePrefixes(strings.Repeat("0", rest), hi[1:]) {
+		result = append(result, hi[:1]+p)
+	}
+	return result
+}
+
+// matchBlacklistRule looks up every prefix of number, in one HMGET, and
+// returns the ID of the rule with the longest matching prefix.
+func matchBlacklistRule(ctx context.Context, redisRepo *repository.RedisRepo, tenantID, number string) (string, bool, error) {
+	values, err := redisRepo.HMGet(ctx, blacklistRuleKey(tenantID), ruleLookupFields(number)...).Result()
+	if err != nil {
+		return "", false, err
+	}
+	id, ok := longestRuleMatch(values)
+	return id, ok, nil
+}
+
+// ruleLookupFields returns the hash fields that match number, from its
+// shortest prefix to the whole number.
+func ruleLookupFields(number string) []string {
+	number = ruleDigits(lookupPhoneNumber(number))
+	lengthSuffix := "#" + strconv.Itoa(len(number))
+	fields := make([]string, 0, 2*len(number))
+	for i := 1; i <= len(number); i++ {
+		fields = append(fields, number[:i], number[:i]+lengthSuffix)
+	}
+	return fields
+}
+
+// longestRuleMatch returns the rule ID of the last field found among the
+// values of the ruleLookupFields, which is the longest matching prefix.
+func longestRuleMatch(values []interface{}) (string, bool) {
+	for i := len(values) - 1; i >= 0; i-- {
+		if id, ok := values[i].(string); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// CreateBlacklistRule stores a rule and refreshes the tenant's rule cache.
+func (b *BlacklistService) CreateBlacklistRule(ctx context.Context, rule *models.BlacklistRule) error {
+	if err := b.db.CreateBlacklistRule(rule); err != nil {
+		return fmt.Errorf("error creating blacklist rule: %w", err)
+	}
+	return b.rebuildRuleCache(ctx, rule.TenantID)
+}
+
+// DeleteBlacklistRule deletes a rule, returning ErrNotFound if the tenant has
+// no rule with that ID.
+func (b *BlacklistService) DeleteBlacklistRule(ctx context.Context, tenantID string, id uint) error {
+	deleted, err := b.db.DeleteBlacklistRule(tenantID, id)
+	if err != nil {
+		return fmt.Errorf("error deleting blacklist rule %d: %w", id, err)
+	}
+	if !deleted {
+		return fmt.Errorf("%w: blacklist rule %d", ErrNotFound, id)
+	}
+	return b.rebuildRuleCache(ctx, tenantID)
+}
+
+// ListBlacklistRules returns the tenant's rules.
+func (b *BlacklistService) ListBlacklistRules(tenantID string) ([]models.BlacklistRule, error) {
+	rules, err := b.db.ListBlacklistRules(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing blacklist rules: %w", err)
+	}
+	return rules, nil
+}
+
+// rebuildRuleCache writes the tenant's rules to a scratch hash and renames it
+// over the live one.
+func (b *BlacklistService) rebuildRuleCache(ctx context.Context, tenantID string) error {
+	rules, err := b.db.ListBlacklistRules(tenantID)
+	if err != nil {
+		return fmt.Errorf("error rebuilding blacklist rules for tenant %s: %w", tenantID, err)
+	}
+	key := blacklistRuleKey(tenantID)
+	if len(rules) == 0 {
+		return b.redisRepo.Del(ctx, key).Err()
+	}
+
+	values := make(map[string]interface{})
+	for _, rule := range rules {
+		for _, field := range ruleFields(rule) {
+			values[field] = strconv.FormatUint(uint64(rule.ID), 10)
+		}
+	}
+	scratch := key + ":rebuild"
+	if err := b.redisRepo.Del(ctx, scratch).Err(); err != nil {
+		return fmt.Errorf("error rebuilding blacklist rules for tenant %s: %w", tenantID, err)
+	}
+	if err := b.redisRepo.HSet(ctx, scratch, values).Err(); err != nil {
+		return fmt.Errorf("error rebuilding blacklist rules for tenant %s: %w", tenantID, err)
+	}
+	if err := b.redisRepo.Rename(ctx, scratch, key).Err(); err != nil {
+		return fmt.Errorf("error rebuilding blacklist rules for tenant %s: %w", tenantID, err)
+	}
+	log.Printf("rebuildRuleCache: Cached %d prefixes for %d rules of tenant %s", len(values), len(rules), tenantID)
+	return nil
+}
+
+// rebuildAllRuleCaches rebuilds the rule hash of every tenant with rules and
+// drops hashes left over from tenants without any.
+func (b *BlacklistService) rebuildAllRuleCaches(ctx context.Context) error {
+	tenants, err := b.db.ListBlacklistRuleTenants()
+	if err != nil {
+		return fmt.Errorf("error rebuilding blacklist rules: %w", err)
+	}
+	keep := make(map[string]bool, len(tenants))
+	for _, tenantID := range tenants {
+		if err := b.rebuildRuleCache(ctx, tenantID); err != nil {
+			return err
+		}
+		keep[blacklistRuleKey(tenantID)] = true
+	}
+	keys, err := b.redisRepo.ScanKeys(ctx, blacklistRuleKey("*"))
+	if err != nil {
+		return fmt.Errorf("error rebuilding blacklist rules: %w", err)
+	}
+	for _, key := range keys {
+		if !keep[key] {
+			if err := b.redisRepo.Del(ctx, key).Err(); err != nil {
+				return fmt.Errorf("error rebuilding blacklist rules: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"notifications/internal/models"
+)
+
+func TestRangePrefixes(t *testing.T) {
+	tests := []struct {
+		lo, hi string
+		want   []string
+	}{
+		{"000", "999", []string{""}},
+		{"100", "199", []string{"1"}},
+		{"5", "5", []string{"5"}},
+		{"120", "135", []string{"12", "130", "131", "132", "133", "134", "135"}},
+		{"18", "31", []string{"18", "19", "2", "30", "31"}},
+		{"0990", "1009", []string{"099", "100"}},
+	}
+	for _, tt := range tests {
+		if got := rangePrefixes(tt.lo, tt.hi); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rangePrefixes(%q, %q) = %q, want %q", tt.lo, tt.hi, got, tt.want)
+		}
+	}
+}
+
+func TestRuleFields(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.BlacklistRule
+		want []string
+	}{
+		{"prefix with plus", models.BlacklistRule{Type: RuleTypePrefix, Prefix: "+92"}, []string{"92"}},
+		{"prefix without plus", models.BlacklistRule{Type: RuleTypePrefix, Prefix: "92"}, []string{"92"}},
+		{
+			"range suffixed with its digit count",
+			models.BlacklistRule{Type: RuleTypeRange, RangeStart: "+919000000000", RangeEnd: "+919000099999"},
+			[]string{"9190000#12"},
+		},
+		{
+			"range without plus",
+			models.BlacklistRule{Type: RuleTypeRange, RangeStart: "9876543180", RangeEnd: "9876543319"},
+			[]string{"987654318#10", "987654319#10", "98765432#10", "987654330#10", "987654331#10"},
+		},
+	}
+	for _, tt := range tests {
+		if got := ruleFields(tt.rule); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ruleFields = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestToRulePatterns(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		wantType   string
+		wantPrefix string
+		wantStart  string
+		wantEnd    string
+		wantErr    bool
+	}{
+		{pattern: "+9190000xxxxx", wantType: RuleTypeRange, wantStart: "+919000000000", wantEnd: "+919000099999"},
+		{pattern: "9876543XXX", wantType: RuleTypeRange, wantStart: "9876543000", wantEnd: "9876543999"},
+		{pattern: "+92300", wantType: RuleTypePrefix, wantPrefix: "+92300"},
+		{pattern: "+92xx", wantErr: true},
+		{pattern: "+9a1xxxxxxx", wantErr: true},
+	}
+	for _, tt := range tests {
+		rule, err := BlacklistRuleInput{Pattern: tt.pattern}.ToRule("tenant", "admin")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ToRule(%q) = %+v, want an error", tt.pattern, rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ToRule(%q): %v", tt.pattern, err)
+			continue
+		}
+		if rule.Type != tt.wantType || rule.Prefix != tt.wantPrefix || rule.RangeStart != tt.wantStart || rule.RangeEnd != tt.wantEnd {
+			t.Errorf("ToRule(%q) = %s %q %q-%q, want %s %q %q-%q", tt.pattern,
+				rule.Type, rule.Prefix, rule.RangeStart, rule.RangeEnd,
+				tt.wantType, tt.wantPrefix, tt.wantStart, tt.wantEnd)
+		}
+	}
+}
+
+func TestLongestRuleMatch(t *testing.T) {
+	rules := []models.BlacklistRule{
+		{ID: 1, Type: RuleTypePrefix, Prefix: "+92"},
+		{ID: 2, Type: RuleTypePrefix, Prefix: "92300"},
+		{ID: 3, Type: RuleTypeRange, RangeStart: "+923001234000", RangeEnd: "+923001234999"},
+	}
+	// The rule hash as rebuildRuleCache stores it
+	hash := make(map[string]string)
+	for _, rule := range rules {
+		for _, field := range ruleFields(rule) {
+			hash[field] = strconv.FormatUint(uint64(rule.ID), 10)
+		}
+	}
+
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"+923001234567", "3"},
+		{"923001234567", "3"},
+		{"+92 300 1234567", "3"},
+		{"923005555555", "2"},
+		{"+9230012345", "2"},
+		{"+923111111111", "1"},
+		{"92311111111", "1"},
+		{"+441234567890", ""},
+	}
+	for _, tt := range tests {
+		fields := ruleLookupFields(tt.number)
+		values := make([]interface{}, len(fields))
+		for i, field := range fields {
+			if id, ok := hash[field]; ok {
+				values[i] = id
+			}
+		}
+		got, ok := longestRuleMatch(values)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("%s matched rule %q (%v), want %q", tt.number, got, ok, tt.want)
+		}
+	}
+}
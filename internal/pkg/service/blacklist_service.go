@@ -4,18 +4,134 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"notifications/internal/models"
 	repository "notifications/internal/pkg/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
 )
 
 // Constants for Redis keys
 const (
-	BlacklistKey = "Black"
+	BlacklistKey       = "Black"
+	BlacklistExpiryKey = "BlackExpiry"
+)
+
+// Reasons a number can be blacklisted for
+const (
+	ReasonUserOptOut = "user_opt_out"
+	ReasonFraud      = "fraud"
+	ReasonLegal      = "legal"
+	ReasonBounce     = "bounce"
+)
+
+// Where a blacklist entry came from
+const (
+	SourceAPI         = "api"
+	SourceInboundStop = "inbound_stop"
+	SourceAdmin       = "admin"
 )
 
-// BlacklistService provides methods to manage blacklisted phone numbers
+// How often expired blacklist entries are swept from MySQL and Redis
+const blacklistSweepInterval = time.Minute
+
+// Actor recorded on events for entries removed by the expiry sweep
+const blacklistExpiryActor = "system:expiry"
+
+// blacklistKey returns the Redis set holding the tenant's blacklist.
+func blacklistKey(tenantID string) string {
+	return BlacklistKey + ":" + tenantID
+}
+
+// blacklistExpiryKey returns the Redis sorted set holding the expiry, as a unix
+// timestamp, of the tenant's temporary blacklist entries.
+func blacklistExpiryKey(tenantID string) string {
+	return BlacklistExpiryKey + ":" + tenantID
+}
+
+// isBlockedInCache reports whether sending to number is blocked, either by an
+// exact blacklist entry or by one of the tenant's prefix and range rules, and
+// whether it was the exact entry.
+func isBlockedInCache(ctx context.Context, redisRepo *repository.RedisRepo, tenantID, number string) (blocked bool, listed bool, err error) {
+	listed, err = isListedInCache(ctx, redisRepo, tenantID, number)
+	if err != nil || listed {
+		return listed, listed, err
+	}
+	_, matched, err := matchBlacklistRule(ctx, redisRepo, tenantID, number)
+	return matched, false, err
+}
+
+// isListedInCache checks the tenant's Redis blacklist set. A number whose entry
+// has expired is reported as not listed even before the sweeper removes it.
+func isListedInCache(ctx context.Context, redisRepo *repository.RedisRepo, tenantID, number string) (bool, error) {
+	isMember, err := redisRepo.SIsMember(ctx, blacklistKey(tenantID), number).Result()
+	if err != nil || !isMember {
+		return false, err
+	}
+	expiresAt, err := redisRepo.ZScore(ctx, blacklistExpiryKey(tenantID), number).Result()
+	if err == redis.Nil {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return time.Now().Unix() < int64(expiresAt), nil
+}
+
+// BlacklistMetadata describes why, by whom and for how long numbers are
+// blacklisted. A nil ExpiresAt blocks the number until it is removed.
+type BlacklistMetadata struct {
+	Reason    string
+	Source    string
+	AddedBy   string
+	ExpiresAt *time.Time
+}
+
+// Validate checks the reason and source and fills in the defaults: a user
+// opt-out coming from the API.
+func (m *BlacklistMetadata) Validate() error {
+	if m.Reason == "" {
+		m.Reason = ReasonUserOptOut
+	}
+	if m.Source == "" {
+		m.Source = SourceAPI
+	}
+	switch m.Reason {
+	case ReasonUserOptOut, ReasonFraud, ReasonLegal, ReasonBounce:
+	default:
+		return fmt.Errorf("%w: invalid blacklist reason %q", ErrValidation, m.Reason)
+	}
+	switch m.Source {
+	case SourceAPI, SourceInboundStop, SourceAdmin:
+	default:
+		return fmt.Errorf("%w: invalid blacklist source %q", ErrValidation, m.Source)
+	}
+	if m.ExpiresAt != nil && !m.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: blacklist expiry %s is in the past", ErrValidation, m.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// BlacklistDrift lists the differences between the MySQL blacklist table and
+// the tenant's Redis blacklist set.
+type BlacklistDrift struct {
+	TenantID       string   `json:"tenant_id"`
+	InSync         bool     `json:"in_sync"`
+	MissingInRedis []string `json:"missing_in_redis"`
+	MissingInMySQL []string `json:"missing_in_mysql"`
+}
+
+// BlacklistService provides methods to manage blacklisted phone numbers.
+// MySQL is the source of truth and Redis serves the lookups; every write goes
+// to both. Numbers are normalized on the way in, so every format of a number
+// finds the same entry. Each change also records a blacklist event in the same MySQL
+// transaction, which the publisher relays to Kafka.
 type BlacklistService struct {
 	db        *repository.MySQLRepo
 	redisRepo *repository.RedisRepo
+	events    *BlacklistEventPublisher
 }
 
 // NewBlacklistService creates a new instance of BlacklistService
@@ -30,27 +146,205 @@ func GetNewBlackListSerevice() *BlacklistService {
 		log.Panic("Error in getting sql db connection")
 
 	}
-	return &BlacklistService{
+	service := &BlacklistService{
 		db:        sqlDb,
 		redisRepo: redisrepo,
+		events:    newBlacklistEventPublisher(sqlDb),
+	}
+	if err := service.RebuildCache(context.Background()); err != nil {
+		log.Panic(err)
+	}
+	go service.sweepExpiredEntries()
+	return service
+}
+
+// sweepExpiredEntries periodically deletes expired entries from both stores.
+func (b *BlacklistService) sweepExpiredEntries() {
+	ticker := time.NewTicker(blacklistSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		entries, err := b.db.ListExpiredBlacklistEntries(now)
+		if err != nil {
+			continue
+		}
+		removed := 0
+		for _, entry := range entries {
+			deleted, err := b.removeNumberFromBlacklist(context.Background(), entry.TenantID, entry.PhoneNumber, blacklistExpiryActor, now)
+			if err != nil {
+				log.Printf("sweepExpiredEntries: %v", err)
+			}
+			if deleted {
+				removed++
+			}
+		}
+		if removed > 0 {
+			log.Printf("sweepExpiredEntries: Removed %d expired blacklist entries", removed)
+		}
+	}
+}
+
+// RebuildCache replaces every Redis blacklist set with the contents of the
+// MySQL blacklist table. Sets of tenants without entries are removed.
+func (b *BlacklistService) RebuildCache(ctx context.Context) error {
+	tenants, err := b.db.ListBlacklistTenants()
+	if err != nil {
+		return fmt.Errorf("error rebuilding blacklist cache: %w", err)
+	}
+	keep := make(map[string]bool, len(tenants))
+	for _, tenantID := range tenants {
+		if err := b.rebuildTenantCache(ctx, tenantID); err != nil {
+			return err
+		}
+		keep[blacklistKey(tenantID)] = true
+	}
+
+	keys, err := b.redisRepo.ScanKeys(ctx, blacklistKey("*"))
+	if err != nil {
+		return fmt.Errorf("error rebuilding blacklist cache: %w", err)
+	}
+	expiryKeys, err := b.redisRepo.ScanKeys(ctx, blacklistExpiryKey("*"))
+	if err != nil {
+		return fmt.Errorf("error rebuilding blacklist cache: %w", err)
+	}
+	for _, tenantID := range tenants {
+		keep[blacklistExpiryKey(tenantID)] = true
+	}
+	for _, key := range append(keys, expiryKeys...) {
+		if !keep[key] && !strings.HasSuffix(key, ":rebuild") {
+			if err := b.redisRepo.Del(ctx, key).Err(); err != nil {
+				return fmt.Errorf("error rebuilding blacklist cache: %w", err)
+			}
+		}
+	}
+	if err := b.rebuildAllRuleCaches(ctx); err != nil {
+		return err
+	}
+	log.Printf("RebuildCache: Rebuilt blacklist cache for %d tenants", len(tenants))
+	return nil
+}
+
+// rebuildTenantCache loads the tenant's numbers into a scratch set and renames
+// it over the live one, so lookups never see a half-built set. The expiry set
+// is rebuilt alongside it.
+func (b *BlacklistService) rebuildTenantCache(ctx context.Context, tenantID string) error {
+	entries, err := b.db.ListBlacklistEntries(tenantID)
+	if err != nil {
+		return fmt.Errorf("error rebuilding blacklist cache for tenant %s: %w", tenantID, err)
+	}
+	key := blacklistKey(tenantID)
+	expiryKey := blacklistExpiryKey(tenantID)
+	if err := b.redisRepo.Del(ctx, expiryKey).Err(); err != nil {
+		return fmt.Errorf("error rebuilding blacklist cache for tenant %s: %w", tenantID, err)
+	}
+	if len(entries) == 0 {
+		return b.redisRepo.Del(ctx, key).Err()
+	}
+
+	numbers := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		numbers = append(numbers, entry.PhoneNumber)
+		if entry.ExpiresAt != nil {
+			if err := b.redisRepo.ZAdd(ctx, expiryKey, float64(entry.ExpiresAt.Unix()), entry.PhoneNumber).Err(); err != nil {
+				return fmt.Errorf("error rebuilding blacklist cache for tenant %s: %w", tenantID, err)
+			}
+		}
+	}
+
+	scratch := key + ":rebuild"
+	if err := b.redisRepo.Del(ctx, scratch).Err(); err != nil {
+		return fmt.Errorf("error rebuilding blacklist cache for tenant %s: %w", tenantID, err)
+	}
+	if err := b.redisRepo.SAddMany(ctx, scratch, numbers); err != nil {
+		return fmt.Errorf("error rebuilding blacklist cache for tenant %s: %w", tenantID, err)
+	}
+	if err := b.redisRepo.Rename(ctx, scratch, key).Err(); err != nil {
+		return fmt.Errorf("error rebuilding blacklist cache for tenant %s: %w", tenantID, err)
 	}
+	return nil
 }
 
-// AddToBlacklist adds phone numbers to the blacklist and returns the results
-func (b *BlacklistService) AddToBlacklist(numbers []string) ([]string, []string, error) {
+// ReconcileBlacklist compares the tenant's MySQL blacklist with its Redis set.
+// With repair set, the Redis set is rebuilt from MySQL when they differ.
+func (b *BlacklistService) ReconcileBlacklist(ctx context.Context, tenantID string, repair bool) (*BlacklistDrift, error) {
+	stored, err := b.db.ListBlacklistNumbers(tenantID)
+	if err != nil {
+		return nil, unavailable("error reconciling blacklist", err)
+	}
+	cached, err := b.redisRepo.SMembers(ctx, blacklistKey(tenantID)).Result()
+	if err != nil {
+		return nil, unavailable("error reconciling blacklist", err)
+	}
+
+	drift := &BlacklistDrift{
+		TenantID:       tenantID,
+		MissingInRedis: difference(stored, cached),
+		MissingInMySQL: difference(cached, stored),
+	}
+	drift.InSync = len(drift.MissingInRedis) == 0 && len(drift.MissingInMySQL) == 0
+	if !drift.InSync {
+		log.Printf("ReconcileBlacklist: Tenant %s has %d numbers missing in Redis and %d missing in MySQL",
+			tenantID, len(drift.MissingInRedis), len(drift.MissingInMySQL))
+		if repair {
+			if err := b.rebuildTenantCache(ctx, tenantID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return drift, nil
+}
+
+// difference returns the values of a that are not in b.
+func difference(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, v := range b {
+		seen[v] = true
+	}
+	result := []string{}
+	for _, v := range a {
+		if !seen[v] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// AddToBlacklist adds phone numbers to the tenant's blacklist and returns the
+// numbers newly blacklisted and those that already were, as recorded in
+// MySQL. Numbers already blacklisted take the new reason, source, actor and
+// expiry too.
+func (b *BlacklistService) AddToBlacklist(tenantID string, numbers []string, metadata BlacklistMetadata) ([]string, []string, error) {
+	if err := metadata.Validate(); err != nil {
+		return nil, nil, err
+	}
 	var successfullyBlacklisted []string
 	var alreadyBlacklisted []string
 	ctx := context.Background()
 
+	normalized := make([]string, 0, len(numbers))
+	seen := make(map[string]bool, len(numbers))
 	for _, number := range numbers {
-		if isBlacklisted, err := b.isNumberBlacklisted(ctx, number); err != nil {
+		number, err := NormalizePhoneNumber(number)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !seen[number] {
+			seen[number] = true
+			normalized = append(normalized, number)
+		}
+	}
+
+	for _, number := range normalized {
+		entry, err := b.db.GetBlacklistEntry(tenantID, number)
+		if err != nil {
+			return nil, nil, unavailable(fmt.Sprintf("error retrieving blacklist entry for number %s", number), err)
+		}
+		if err := b.AddNumberToBlacklist(ctx, tenantID, number, metadata); err != nil {
 			return nil, nil, err
-		} else if isBlacklisted {
+		}
+		if entry != nil && !entry.IsExpired(time.Now()) {
 			alreadyBlacklisted = append(alreadyBlacklisted, number)
 		} else {
-			if err := b.AddNumberToBlacklist(ctx, number); err != nil {
-				return nil, nil, err
-			}
 			successfullyBlacklisted = append(successfullyBlacklisted, number)
 		}
 	}
@@ -58,61 +352,210 @@ func (b *BlacklistService) AddToBlacklist(numbers []string) ([]string, []string,
 	return successfullyBlacklisted, alreadyBlacklisted, nil
 }
 
-// RemoveFromBlacklist removes a phone number from the blacklist
-func (b *BlacklistService) RemoveFromBlacklist(number string) error {
-	ctx := context.Background()
-
-	if isBlacklisted, err := b.isNumberBlacklisted(ctx, number); err != nil {
+// RemoveFromBlacklist removes a phone number from the tenant's blacklist on
+// behalf of actor. Whether the number is listed is decided by MySQL, so an
+// entry missing from Redis can still be removed.
+func (b *BlacklistService) RemoveFromBlacklist(tenantID string, number string, actor string) error {
+	number, err := NormalizePhoneNumber(number)
+	if err != nil {
 		return err
-	} else if !isBlacklisted {
-		return fmt.Errorf("number %s is not blacklisted", number)
 	}
+	entry, err := b.db.GetBlacklistEntry(tenantID, number)
+	if err != nil {
+		return unavailable(fmt.Sprintf("error retrieving blacklist entry for number %s", number), err)
+	}
+	if entry == nil {
+		return fmt.Errorf("%w: number %s is not blacklisted", ErrNotFound, number)
+	}
+
+	_, err = b.removeNumberFromBlacklist(context.Background(), tenantID, number, actor, time.Time{})
+	return err
+}
 
-	return b.removeNumberFromBlacklist(ctx, number)
+// Close stops publishing blacklist events and flushes the ones in flight.
+func (b *BlacklistService) Close() {
+	b.events.Close()
 }
 
-// GetAllFromBlacklist retrieves all blacklisted phone numbers
-func (b *BlacklistService) GetAllFromBlacklist(ctx context.Context) ([]string, error) {
-	blacklist, err := b.redisRepo.SMembers(ctx, BlacklistKey).Result()
+// BlacklistPage is one page of a blacklist listing. NextCursor is empty on the
+// last page. Total is the size of the whole blacklist, ignoring any prefix.
+type BlacklistPage struct {
+	Numbers    []string
+	NextCursor string
+	Total      int64
+}
+
+// Upper bound on SSCAN calls per page, so a rare prefix can't make one request
+// walk a huge set
+const maxScansPerPage = 50
+
+// ListBlacklist returns a page of the tenant's blacklisted numbers using SSCAN,
+// starting at cursor ("" or "0" for the first page). SSCAN works in steps of
+// roughly limit elements, so a page can hold slightly more than limit numbers
+// and, with a sparse prefix filter, fewer; callers should keep following
+// NextCursor until it is empty.
+func (b *BlacklistService) ListBlacklist(ctx context.Context, tenantID string, cursor string, limit int64, prefix string) (*BlacklistPage, error) {
+	var position uint64
+	if cursor != "" {
+		parsed, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor %q", ErrValidation, cursor)
+		}
+		position = parsed
+	}
+	match := ""
+	if prefix != "" {
+		match = escapeGlob(prefix) + "*"
+	}
+
+	key := blacklistKey(tenantID)
+	page := &BlacklistPage{Numbers: []string{}}
+	for scans := 0; scans < maxScansPerPage; scans++ {
+		numbers, next, err := b.redisRepo.SScan(ctx, key, position, match, limit).Result()
+		if err != nil {
+			log.Printf("Error retrieving blacklisted numbers: %v", err)
+			return nil, unavailable("error retrieving blacklisted numbers", err)
+		}
+		page.Numbers = append(page.Numbers, numbers...)
+		position = next
+		if position == 0 || int64(len(page.Numbers)) >= limit {
+			break
+		}
+	}
+	if position != 0 {
+		page.NextCursor = strconv.FormatUint(position, 10)
+	}
+
+	total, err := b.redisRepo.SCard(ctx, key).Result()
 	if err != nil {
-		log.Printf("Error retrieving blacklisted numbers: %v", err)
-		return nil, fmt.Errorf("error retrieving blacklisted numbers: %w", err)
+		log.Printf("Error counting blacklisted numbers: %v", err)
+		return nil, unavailable("error counting blacklisted numbers", err)
 	}
-	return blacklist, nil
+	page.Total = total
+	return page, nil
 }
 
-// IsNumberBlacklisted checks if a phone number is blacklisted
-func (b *BlacklistService) IsNumberBlacklisted(ctx context.Context, number string) (bool, error) {
-	return b.isNumberBlacklisted(ctx, number)
+// escapeGlob escapes the characters Redis MATCH patterns treat specially.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
 }
 
-// Helper method to check if a number is blacklisted
-func (b *BlacklistService) isNumberBlacklisted(ctx context.Context, number string) (bool, error) {
-	isBlacklisted, err := b.redisRepo.SIsMember(ctx, BlacklistKey, number).Result()
+// GetBlacklistEntry returns the metadata of the number's active blacklist
+// entry, or ErrNotFound if the number isn't blacklisted or the entry has expired.
+func (b *BlacklistService) GetBlacklistEntry(tenantID string, number string) (*models.BlacklistEntry, error) {
+	number, err := NormalizePhoneNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := b.db.GetBlacklistEntry(tenantID, number)
+	if err != nil {
+		return nil, unavailable(fmt.Sprintf("error retrieving blacklist entry for number %s", number), err)
+	}
+	if entry == nil || entry.IsExpired(time.Now()) {
+		return nil, fmt.Errorf("%w: number %s is not blacklisted", ErrNotFound, number)
+	}
+	return entry, nil
+}
+
+// IsNumberBlacklisted checks if sending to a phone number is blocked, by an
+// exact entry or by one of the tenant's rules
+func (b *BlacklistService) IsNumberBlacklisted(ctx context.Context, tenantID string, number string) (bool, error) {
+	isBlocked, _, err := isBlockedInCache(ctx, b.redisRepo, tenantID, lookupPhoneNumber(number))
 	if err != nil {
 		log.Printf("Error checking blacklist status for number %s: %v", number, err)
-		return false, fmt.Errorf("error checking blacklist status for number %s: %w", number, err)
+		return false, unavailable(fmt.Sprintf("error checking blacklist status for number %s", number), err)
 	}
-	return isBlacklisted, nil
+	return isBlocked, nil
 }
 
 // Helper method to add a number to the blacklist
-func (b *BlacklistService) AddNumberToBlacklist(ctx context.Context, number string) error {
-	err := b.redisRepo.SAdd(ctx, BlacklistKey, number).Err()
+func (b *BlacklistService) AddNumberToBlacklist(ctx context.Context, tenantID string, number string, metadata BlacklistMetadata) error {
+	entry := &models.BlacklistEntry{
+		TenantID:    tenantID,
+		PhoneNumber: number,
+		Reason:      metadata.Reason,
+		Source:      metadata.Source,
+		AddedBy:     metadata.AddedBy,
+		ExpiresAt:   metadata.ExpiresAt,
+	}
+	err := b.db.Transaction(func(tx *repository.MySQLRepo) error {
+		if err := tx.AddBlacklistEntry(entry); err != nil {
+			return err
+		}
+		return tx.CreateBlacklistEvents([]models.BlacklistEvent{blacklistEvent(EventBlacklistAdded, *entry, metadata.AddedBy)})
+	})
+	if err != nil {
+		log.Printf("Error storing blacklisted number %s: %v", number, err)
+		return unavailable(fmt.Sprintf("error adding number %s to blacklist", number), err)
+	}
+
+	if metadata.ExpiresAt != nil {
+		err = b.redisRepo.ZAdd(ctx, blacklistExpiryKey(tenantID), float64(metadata.ExpiresAt.Unix()), number).Err()
+	} else {
+		err = b.redisRepo.ZRem(ctx, blacklistExpiryKey(tenantID), number).Err()
+	}
+	if err != nil {
+		log.Printf("Error setting blacklist expiry for number %s: %v", number, err)
+		return unavailable(fmt.Sprintf("error adding number %s to blacklist", number), err)
+	}
+
+	err = b.redisRepo.SAdd(ctx, blacklistKey(tenantID), number).Err()
 	if err != nil {
 		log.Printf("Error adding number %s to blacklist: %v", number, err)
-		return fmt.Errorf("error adding number %s to blacklist: %w", number, err)
+		return unavailable(fmt.Sprintf("error adding number %s to blacklist", number), err)
 	}
 	return nil
 }
 
-// Helper method to remove a number from the blacklist
-func (b *BlacklistService) removeNumberFromBlacklist(ctx context.Context, number string) error {
-	err := b.redisRepo.SRem(ctx, BlacklistKey, number).Err()
+// removeNumberFromBlacklist removes the number from the tenant's blacklist and
+// reports whether this call removed it. With expiredBy set, the entry is only
+// removed if it still expires by then. The removal event is only recorded by
+// the call that deleted the row, so concurrent removals emit it once.
+func (b *BlacklistService) removeNumberFromBlacklist(ctx context.Context, tenantID string, number string, actor string, expiredBy time.Time) (bool, error) {
+	deleted := false
+	err := b.db.Transaction(func(tx *repository.MySQLRepo) error {
+		entry, err := tx.GetBlacklistEntry(tenantID, number)
+		if err != nil || entry == nil {
+			return err
+		}
+		if expiredBy.IsZero() {
+			deleted, err = tx.DeleteBlacklistEntry(tenantID, number)
+		} else {
+			deleted, err = tx.DeleteExpiredBlacklistEntry(tenantID, number, expiredBy)
+		}
+		if err != nil || !deleted {
+			return err
+		}
+		return tx.CreateBlacklistEvents([]models.BlacklistEvent{blacklistEvent(EventBlacklistRemoved, *entry, actor)})
+	})
+	if err != nil {
+		log.Printf("Error deleting blacklisted number %s: %v", number, err)
+		return false, unavailable(fmt.Sprintf("error removing number %s from blacklist", number), err)
+	}
+	if !deleted {
+		// Removed by someone else, or kept by a new expiry
+		return false, nil
+	}
+
+	err = b.redisRepo.SRem(ctx, blacklistKey(tenantID), number).Err()
+	if err == nil {
+		err = b.redisRepo.ZRem(ctx, blacklistExpiryKey(tenantID), number).Err()
+	}
+	if err == nil {
+		err = b.clearBlacklistHits(ctx, tenantID, number)
+	}
 	if err != nil {
 		log.Printf("Error removing number %s from blacklist: %v", number, err)
-		return fmt.Errorf("error removing number %s from blacklist: %w", number, err)
+		return true, unavailable(fmt.Sprintf("error removing number %s from blacklist", number), err)
 	}
 	log.Printf("Number %s successfully removed from blacklist", number)
-	return nil
+	return true, nil
 }
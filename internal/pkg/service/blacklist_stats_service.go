@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"notifications/internal/pkg/repository"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys of the blacklist hit statistics. They don't match "Black:*", so
+// cache rebuilds leave them alone.
+const (
+	BlacklistHitsKey    = "BlackHits"
+	BlacklistLastHitKey = "BlackLastHit"
+	BlacklistDailyKey   = "BlackDaily"
+)
+
+const (
+	// How long the per-day counters are kept
+	blacklistDailyRetention = 90 * 24 * time.Hour
+	// Layout of the day in the per-day counter keys
+	blacklistDayLayout = "2006-01-02"
+)
+
+func blacklistHitsKey(tenantID string) string {
+	return BlacklistHitsKey + ":" + tenantID
+}
+
+func blacklistLastHitKey(tenantID string) string {
+	return BlacklistLastHitKey + ":" + tenantID
+}
+
+func blacklistDailyKey(tenantID string, day string) string {
+	return BlacklistDailyKey + ":" + tenantID + ":" + day
+}
+
+// blacklistDay returns the day a hit at t is counted under, in the same IST
+// shifted clock the daily quota uses.
+func blacklistDay(t time.Time) string {
+	return t.UTC().Add(5*time.Hour + 30*time.Minute).Format(blacklistDayLayout)
+}
+
+// recordBlacklistHit counts a blocked send to the number in the daily counter.
+// Only numbers blocked by their own entry (listed) get per-number counts:
+// those are dropped with the entry, while the numbers a rule matches are
+// unbounded and nothing would ever drop them. Failing to record a hit is only
+// logged, so statistics never block a send.
+func recordBlacklistHit(ctx context.Context, redisRepo *repository.RedisRepo, tenantID, number string, listed bool) {
+	now := time.Now()
+	dailyKey := blacklistDailyKey(tenantID, blacklistDay(now))
+	var err error
+	if listed {
+		err = redisRepo.RecordHit(ctx, number, now, blacklistHitsKey(tenantID), blacklistLastHitKey(tenantID), dailyKey, blacklistDailyRetention)
+	} else {
+		err = redisRepo.IncrWithTTL(ctx, dailyKey, blacklistDailyRetention)
+	}
+	if err != nil {
+		log.Printf("recordBlacklistHit: Failed to record hit for %s: %v", number, err)
+	}
+}
+
+// BlacklistHitCount is how often sends to a number were blocked by its
+// blacklist entry.
+type BlacklistHitCount struct {
+	Number    string     `json:"number"`
+	Hits      int64      `json:"hits"`
+	LastHitAt *time.Time `json:"last_hit_at,omitempty"`
+}
+
+// DailyBlockedCount is the number of sends blocked on one day.
+type DailyBlockedCount struct {
+	Day     string `json:"day"`
+	Blocked int64  `json:"blocked"`
+}
+
+// TopBlockedNumbers returns the limit blacklisted numbers with the most
+// blocked sends, most hit first.
+func (b *BlacklistService) TopBlockedNumbers(ctx context.Context, tenantID string, limit int64) ([]BlacklistHitCount, error) {
+	top, err := b.redisRepo.ZRevRangeWithScores(ctx, blacklistHitsKey(tenantID), 0, limit-1).Result()
+	if err != nil {
+		log.Printf("TopBlockedNumbers: Error reading hit counts: %v", err)
+		return nil, unavailable("error reading blacklist hit counts", err)
+	}
+
+	numbers := make([]string, len(top))
+	for i, z := range top {
+		numbers[i], _ = z.Member.(string)
+	}
+	lastHits, err := b.redisRepo.ZScores(ctx, blacklistLastHitKey(tenantID), numbers)
+	if err != nil {
+		return nil, unavailable("error reading last blacklist hits", err)
+	}
+
+	counts := make([]BlacklistHitCount, len(top))
+	for i, z := range top {
+		counts[i] = BlacklistHitCount{Number: numbers[i], Hits: int64(z.Score)}
+		if score, ok := lastHits[numbers[i]]; ok {
+			lastHitAt := time.Unix(int64(score), 0).UTC()
+			counts[i].LastHitAt = &lastHitAt
+		}
+	}
+	return counts, nil
+}
+
+// DailyBlockedCounts returns the blocked sends of each of the last days days,
+// oldest first. Days without hits are reported as zero.
+func (b *BlacklistService) DailyBlockedCounts(ctx context.Context, tenantID string, days int) ([]DailyBlockedCount, error) {
+	now := time.Now()
+	counts := make([]DailyBlockedCount, days)
+	keys := make([]string, days)
+	for i := range counts {
+		day := blacklistDay(now.AddDate(0, 0, i-days+1))
+		counts[i].Day = day
+		keys[i] = blacklistDailyKey(tenantID, day)
+	}
+
+	values, err := b.redisRepo.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("DailyBlockedCounts: Error reading daily counters: %v", err)
+		return nil, unavailable("error reading daily blacklist counters", err)
+	}
+	for i, value := range values {
+		if raw, ok := value.(string); ok {
+			counts[i].Blocked, _ = strconv.ParseInt(raw, 10, 64)
+		}
+	}
+	return counts, nil
+}
+
+// LastHitAt returns when a send to the number was last blocked, or nil if
+// it never was.
+func (b *BlacklistService) LastHitAt(ctx context.Context, tenantID string, number string) (*time.Time, error) {
+	number = lookupPhoneNumber(number)
+	score, err := b.redisRepo.ZScore(ctx, blacklistLastHitKey(tenantID), number).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("LastHitAt: Error reading last hit of %s: %v", number, err)
+		return nil, unavailable(fmt.Sprintf("error reading last blacklist hit of %s", number), err)
+	}
+	lastHitAt := time.Unix(int64(score), 0).UTC()
+	return &lastHitAt, nil
+}
+
+// clearBlacklistHits drops the per-number statistics of a removed entry. The
+// daily counters are kept.
+func (b *BlacklistService) clearBlacklistHits(ctx context.Context, tenantID string, number string) error {
+	if err := b.redisRepo.ZRem(ctx, blacklistHitsKey(tenantID), number).Err(); err != nil {
+		return err
+	}
+	return b.redisRepo.ZRem(ctx, blacklistLastHitKey(tenantID), number).Err()
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Query is an Elasticsearch query clause. Clauses are only ever built from
+// the constructors below and marshalled, never formatted into JSON text, so
+// values taken from a request can't change the structure of a query.
+type Query map[string]interface{}
+
+// Term matches documents whose field is exactly value.
+func Term(field string, value interface{}) Query {
+	return Query{"term": map[string]interface{}{field: value}}
+}
+
+// Terms matches documents whose field is any of values.
+func Terms(field string, values ...string) Query {
+	return Query{"terms": map[string]interface{}{field: values}}
+}
+
+// IDs matches documents by their document ID.
+func IDs(ids ...string) Query {
+	return Query{"ids": map[string]interface{}{"values": ids}}
+}
+
+// Match is a full text match of text on field. With the "and" operator
+// every word of text has to match.
+func Match(field string, text string, operator string) Query {
+	return Query{"match": map[string]interface{}{
+		field: map[string]interface{}{"query": text, "operator": operator},
+	}}
+}
+
+// MultiMatch is a full text match of text on each of fields, scored by the
+// best matching one.
+func MultiMatch(text string, operator string, fields ...string) Query {
+	return Query{"multi_match": map[string]interface{}{
+		"query":    text,
+		"operator": operator,
+		"fields":   fields,
+	}}
+}
+
+// MessageMatch matches messages containing every word of text, as written or
+// with case, accents, digits and Indic spellings folded.
+func MessageMatch(text string) Query {
+	return MultiMatch(text, "and", "message", "message.folded")
+}
+
+// DateRange matches documents whose date field lies between from and to,
+// both inclusive. A zero bound leaves that side open.
+func DateRange(field string, from time.Time, to time.Time) Query {
+	bounds := map[string]interface{}{"format": DateFormat}
+	if !from.IsZero() {
+		bounds["gte"] = from.Format(time.RFC3339)
+	}
+	if !to.IsZero() {
+		bounds["lte"] = to.Format(time.RFC3339)
+	}
+	return Query{"range": map[string]interface{}{field: bounds}}
+}
+
+// BoolQuery combines clauses. Filter clauses don't count towards the score.
+type BoolQuery struct {
+	Must    []Query
+	Filter  []Query
+	Should  []Query
+	MustNot []Query
+}
+
+// Query returns the bool clause, leaving out empty occurrence types.
+func (b BoolQuery) Query() Query {
+	clause := map[string]interface{}{}
+	for name, clauses := range map[string][]Query{
+		"must":     b.Must,
+		"filter":   b.Filter,
+		"should":   b.Should,
+		"must_not": b.MustNot,
+	} {
+		if len(clauses) > 0 {
+			clause[name] = clauses
+		}
+	}
+	return Query{"bool": clause}
+}
+
+// tenantQuery restricts the clauses to the tenant's documents.
+func tenantQuery(tenantID string, must ...Query) Query {
+	return BoolQuery{Must: must, Filter: []Query{Term("tenant_id", tenantID)}}.Query()
+}
+
+// searchRequest returns the body of a search request running query.
+func searchRequest(query Query) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query})
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
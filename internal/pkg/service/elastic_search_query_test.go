@@ -0,0 +1,149 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// hostileInputs are request values that would break out of their string if
+// they were formatted into JSON text.
+var hostileInputs = map[string]string{
+	"plain":            "hello",
+	"empty":            "",
+	"quote":            `he said "hi"`,
+	"backslash":        `C:\temp\"`,
+	"braces":           `{}}}{{`,
+	"match all":        `"}},{"match_all":{}},{"term":{"x":"`,
+	"closing query":    `"}}]}},"size":10000,"query":{"match_all":{}}}`,
+	"control chars":    "line\nbreak\ttab\x00nul",
+	"unicode":          "नमस्ते ☎ 😀 \u2028\u2029",
+	"escaped unicode":  `\u0022}},{\u0022match_all\u0022:{}}`,
+	"html":             `<script>alert("x")</script>`,
+	"invalid utf8 run": "\xff\xfe",
+}
+
+// decode marshals v and decodes it back into plain JSON values, so queries
+// built by the constructors can be compared with the structure they should
+// produce.
+func decode(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("unmarshal %s: %v", body, err)
+	}
+	return decoded
+}
+
+// roundTrip is what a value looks like after a JSON round trip; invalid UTF-8
+// is replaced, but never interpreted.
+func roundTrip(t *testing.T, value string) string {
+	t.Helper()
+	decoded, _ := decode(t, value).(string)
+	return decoded
+}
+
+func TestQueriesKeepHostileInputsAsValues(t *testing.T) {
+	for name, input := range hostileInputs {
+		t.Run(name, func(t *testing.T) {
+			value := roundTrip(t, input)
+
+			body, err := searchRequest(tenantQuery(input, MessageMatch(input), Term("status", input), IDs(input)))
+			if err != nil {
+				t.Fatalf("searchRequest: %v", err)
+			}
+			var got interface{}
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("searchRequest returned invalid JSON %s: %v", body, err)
+			}
+
+			want := map[string]interface{}{
+				"query": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"must": []interface{}{
+							map[string]interface{}{"multi_match": map[string]interface{}{
+								"query":    value,
+								"operator": "and",
+								"fields":   []interface{}{"message", "message.folded"},
+							}},
+							map[string]interface{}{"term": map[string]interface{}{"status": value}},
+							map[string]interface{}{"ids": map[string]interface{}{"values": []interface{}{value}}},
+						},
+						"filter": []interface{}{
+							map[string]interface{}{"term": map[string]interface{}{"tenant_id": value}},
+						},
+					},
+				},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("query structure changed:\n got  %s\n want %s", body, mustMarshal(t, want))
+			}
+		})
+	}
+}
+
+func TestConstructorsKeepHostileInputsAsValues(t *testing.T) {
+	for name, input := range hostileInputs {
+		t.Run(name, func(t *testing.T) {
+			value := roundTrip(t, input)
+
+			cases := []struct {
+				name  string
+				query Query
+				want  interface{}
+			}{
+				{
+					name:  "MessageMatch",
+					query: MessageMatch(input),
+					want: map[string]interface{}{"multi_match": map[string]interface{}{
+						"query":    value,
+						"operator": "and",
+						"fields":   []interface{}{"message", "message.folded"},
+					}},
+				},
+				{
+					name:  "Term",
+					query: Term("phone_number", input),
+					want:  map[string]interface{}{"term": map[string]interface{}{"phone_number": value}},
+				},
+				{
+					name:  "Term field",
+					query: Term(input, "x"),
+					want:  map[string]interface{}{"term": map[string]interface{}{value: "x"}},
+				},
+				{
+					name:  "IDs",
+					query: IDs(input, "other"),
+					want:  map[string]interface{}{"ids": map[string]interface{}{"values": []interface{}{value, "other"}}},
+				},
+				{
+					name:  "tenantQuery",
+					query: tenantQuery(input),
+					want: map[string]interface{}{"bool": map[string]interface{}{
+						"filter": []interface{}{
+							map[string]interface{}{"term": map[string]interface{}{"tenant_id": value}},
+						},
+					}},
+				},
+			}
+			for _, c := range cases {
+				if got := decode(t, c.query); !reflect.DeepEqual(got, c.want) {
+					t.Errorf("%s: got %s, want %s", c.name, mustMarshal(t, c.query), mustMarshal(t, c.want))
+				}
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return body
+}
@@ -2,9 +2,11 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	config "notifications/configurations"
 	"notifications/internal/pkg/repository"
 	"time"
 )
@@ -30,48 +32,49 @@ func GetElasticService() *ElasticsearchService {
 	if err!=nil{
 		log.Panic(err)
 	}
-	return &ElasticsearchService{repo: elasticrepo}
+	service := &ElasticsearchService{repo: elasticrepo}
+	go service.manageIndices()
+	return service
 }
 
-func (e *ElasticsearchService) GetAllDocuments(index string) ([]map[string]interface{}, error) {
-	query := `{
-		"query": {
-			"match_all": {}
+// manageIndices periodically rolls the write alias over to the index of the
+// current period and applies the retention to old indices.
+func (e *ElasticsearchService) manageIndices() {
+	ticker := time.NewTicker(config.ElasticsearchLifecycleEvery)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+		if err := e.repo.RollSMSIndex(now); err != nil {
+			log.Printf("manageIndices: Failed to roll SMS index: %v", err)
+		}
+		if err := e.repo.ApplyRetention(now); err != nil {
+			log.Printf("manageIndices: Failed to apply retention: %v", err)
 		}
-	}`
-
-	res, err := e.repo.Search(index, query)
-	if err != nil {
-		return nil, e.HandleError("GetAllDocuments", err, index)
 	}
-	defer res.Body.Close()
+}
 
-	searchResults, err := e.DecodeSearchResults(res.Body)
+// GetAllDocuments returns one page of the tenant's documents in index.
+func (e *ElasticsearchService) GetAllDocuments(tenantID string, index string, limit int, cursor string) (*repository.SearchPage, error) {
+	query := tenantQuery(tenantID)
+
+	page, err := e.searchPage("GetAllDocuments", index, query, repository.SearchRequest{Limit: limit, Cursor: cursor})
 	if err != nil {
 		return nil, err
 	}
 
-	var allDocs []map[string]interface{}
-	for _, hit := range searchResults.Hits.Hits {
-		allDocs = append(allDocs, hit.Source)
-	}
-
-	log.Printf("GetAllDocuments: Retrieved %d documents from index %s", len(allDocs), index)
-	return allDocs, nil
+	log.Printf("GetAllDocuments: Retrieved %d of %d documents from index %s", len(page.Hits), page.Total, index)
+	return page, nil
 }
 
-func (e *ElasticsearchService) GetDocumentByID(index string, id string) (map[string]interface{}, error) {
+func (e *ElasticsearchService) GetDocumentByID(tenantID string, index string, id string) (map[string]interface{}, error) {
 	if id == "" {
-		return nil, fmt.Errorf(ErrEmptyDocumentID)
+		return nil, fmt.Errorf("%w: %s", ErrValidation, ErrEmptyDocumentID)
 	}
 
-	query := fmt.Sprintf(`{
-		"query": {
-			"ids": {
-				"values": ["%s"]
-			}
-		}
-	}`, id)
+	query, err := searchRequest(tenantQuery(tenantID, IDs(id)))
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling query: %w", err)
+	}
 
 	res, err := e.repo.Search(index, query)
 	if err != nil {
@@ -86,7 +89,7 @@ func (e *ElasticsearchService) GetDocumentByID(index string, id string) (map[str
 
 	if len(searchResults.Hits.Hits) == 0 {
 		log.Printf("GetDocumentByID: Document ID %s not found in index %s", id, index)
-		return nil, nil
+		return nil, fmt.Errorf("%w: document %s", ErrNotFound, id)
 	}
 
 	doc := searchResults.Hits.Hits[0].Source
@@ -94,78 +97,60 @@ func (e *ElasticsearchService) GetDocumentByID(index string, id string) (map[str
 	return doc, nil
 }
 
-func (e *ElasticsearchService) SearchByText(index string, text string) ([]map[string]interface{}, error) {
-	query := fmt.Sprintf(`{
-		"query": {
-			"match": {
-				"message": {
-					"query": "%s",
-					"operator": "and"
-				}
-			}
-		}
-	}`, text)
+// SearchByText returns one page of the tenant's documents whose message
+// contains every word of text.
+func (e *ElasticsearchService) SearchByText(tenantID string, index string, text string, limit int, cursor string) (*repository.SearchPage, error) {
+	query := tenantQuery(tenantID, MessageMatch(text))
 
-	res, err := e.repo.Search(index, query)
-	if err != nil {
-		return nil, e.HandleError("SearchByText", err, index)
-	}
-	defer res.Body.Close()
-
-	searchResults, err := e.DecodeSearchResults(res.Body)
+	page, err := e.searchPage("SearchByText", index, query, repository.SearchRequest{Limit: limit, Cursor: cursor})
 	if err != nil {
 		return nil, err
 	}
 
-	var matchingDocs []map[string]interface{}
-	for _, hit := range searchResults.Hits.Hits {
-		matchingDocs = append(matchingDocs, hit.Source)
-	}
-
-	log.Printf("SearchByText: Retrieved %d documents containing text '%s' from index %s", len(matchingDocs), text, index)
-	return matchingDocs, nil
+	log.Printf("SearchByText: Retrieved %d of %d documents containing text '%s' from index %s", len(page.Hits), page.Total, text, index)
+	return page, nil
 }
 
-func (e *ElasticsearchService) SearchByTimeRange(index string, startTime time.Time, endTime time.Time) ([]map[string]interface{}, error) {
-	startTimeStr := startTime.Format(time.RFC3339)
-	endTimeStr := endTime.Format(time.RFC3339)
-
-	query := fmt.Sprintf(`{
-		"query": {
-			"range": {
-				"created_at": {
-					"gte": "%s",
-					"lte": "%s",
-					"format": "strict_date_optional_time"
-				}
-			}
-		}
-	}`, startTimeStr, endTimeStr)
+// SearchByTimeRange returns one page of the tenant's documents created
+// between startTime and endTime.
+func (e *ElasticsearchService) SearchByTimeRange(tenantID string, index string, startTime time.Time, endTime time.Time, limit int, cursor string) (*repository.SearchPage, error) {
+	query := tenantQuery(tenantID, DateRange("created_at", startTime, endTime))
 
-	res, err := e.repo.Search(index, query)
-	if err != nil {
-		return nil, e.HandleError("SearchByTimeRange", err, index)
+	// Only search the period indices the range overlaps
+	if index == "" || index == config.ElasticsearchSMSAlias {
+		index = repository.SMSIndexPattern(startTime, endTime)
 	}
-	defer res.Body.Close()
-
-	searchResults, err := e.DecodeSearchResults(res.Body)
+	page, err := e.searchPage("SearchByTimeRange", index, query, repository.SearchRequest{Limit: limit, Cursor: cursor})
 	if err != nil {
 		return nil, err
 	}
 
-	var docsInRange []map[string]interface{}
-	for _, hit := range searchResults.Hits.Hits {
-		docsInRange = append(docsInRange, hit.Source)
-	}
+	log.Printf("SearchByTimeRange: Retrieved %d of %d documents from index %s between %s and %s", len(page.Hits), page.Total, index, startTime.Format(time.RFC3339), endTime.Format(time.RFC3339))
+	return page, nil
+}
 
-	log.Printf("SearchByTimeRange: Retrieved %d documents from index %s between %s and %s", len(docsInRange), index, startTimeStr, endTimeStr)
-	return docsInRange, nil
+// searchPage reads one page of the hits of query from index. The query clause
+// of request is set from query.
+func (e *ElasticsearchService) searchPage(methodName string, index string, query Query, request repository.SearchRequest) (*repository.SearchPage, error) {
+	clause, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling query: %w", err)
+	}
+	request.Query = clause
+	page, err := e.repo.SearchAfter(index, request)
+	if errors.Is(err, repository.ErrInvalidCursor) || errors.Is(err, repository.ErrInvalidPageSize) {
+		return nil, fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+	if err != nil {
+		return nil, e.HandleError(methodName, err, index)
+	}
+	return page, nil
 }
 
 // HandleError handles Elasticsearch errors and logs them
 func (e *ElasticsearchService) HandleError(methodName string, err error, index string) error {
 	log.Printf("%s: %s in index %s: %v", methodName, ErrElasticsearchSearch, index, err)
-	return fmt.Errorf("%s: %w", ErrElasticsearchSearch, err)
+	return unavailable(ErrElasticsearchSearch, err)
 }
 
 // DecodeSearchResults decodes the Elasticsearch search results
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of service errors. Service methods wrap one of these around the
+// details, and controllers pick the HTTP status with errors.Is instead of
+// matching on error text.
+var (
+	// ErrNotFound means the requested entry doesn't exist for the tenant
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists means the entry to create is already there
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrValidation means the caller's input was rejected
+	ErrValidation = errors.New("invalid input")
+	// ErrUnauthorized means the request carries no valid API key
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden means the caller may not act on the requested tenant
+	ErrForbidden = errors.New("forbidden")
+	// ErrOverQuota means the tenant used up its SMS quota
+	ErrOverQuota = errors.New("over quota")
+	// ErrBlacklisted means the SMS is addressed to a blacklisted number
+	ErrBlacklisted = errors.New("blacklisted")
+	// ErrUnavailable means a backing store (Redis, Kafka, Elasticsearch)
+	// could not be reached; the request may succeed if retried
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// unavailable wraps a failed call to a backing store as ErrUnavailable.
+func unavailable(message string, err error) error {
+	return fmt.Errorf("%w: %s: %w", ErrUnavailable, message, err)
+}
@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	config "notifications/configurations"
@@ -26,17 +31,69 @@ const (
 	ErrIndexElasticsearch = "failed to index SMS in Elasticsearch"
 	ErrNoMessages         = "no messages to process"
 	ErrParseTimestamp     = "error parsing timestamp"
+	ErrDeliveryKafka      = "failed to deliver message to Kafka"
+	ErrAllowlistCheck     = "error checking allowlist status"
+	ErrProducerClosed     = "producer is closed"
 )
 
+// SMS statuses set by the Kafka delivery report handler
+const (
+	StatusQueued         = "Queued"
+	StatusDeliveryFailed = "DeliveryFailed"
+)
+
+// Status of messages not sent because allowlist mode is on and the number
+// isn't allowlisted
+const StatusNotAllowlisted = "NotAllowlisted"
+
+// Status of messages sent by the consumer
+const StatusSuccessful = "Successful"
+
+// Status of messages not sent because the number is blacklisted
+const StatusFailed = "Failed"
+
 type MessageService struct {
 	db              *repository.MySQLRepo
 	producer        *kafka.Producer
 	kafkaConsumer   *kafka.Consumer
 	redisRepo       *repository.RedisRepo
-	esRepo          *repository.ElasticsearchRepo
-	processingQueue []string
-	incomingQueue   []string
+	indexer         *SMSIndexer
+	tenants         *TenantService
+	processingQueue []queuedMessage
+	incomingQueue   []queuedMessage
 	queueSwitch     bool
+	closed          atomic.Bool
+	replays         replayJobs
+
+	// produceMu keeps Close from closing the producer during a Produce call
+	produceMu      sync.RWMutex
+	producerClosed bool
+
+	// retries holds the pending retries by Kafka key
+	retryMu sync.Mutex
+	retries map[string]*pendingRetry
+}
+
+// pendingRetry holds back the messages of one Kafka key while a failed
+// delivery of the key waits out its backoff: the failed messages first, then
+// the SMS accepted for the key since, so none of them overtakes the retry.
+type pendingRetry struct {
+	timer    *time.Timer
+	failed   int
+	messages []retryMessage
+}
+
+// retryMessage is an SMS ID to produce with its attempt number.
+type retryMessage struct {
+	id      string
+	attempt int
+}
+
+// queuedMessage is an SMS ID read from Kafka together with the message key
+// it was partitioned by.
+type queuedMessage struct {
+	ID  string
+	Key string
 }
 
 var MSGS []models.SMS
@@ -67,31 +124,32 @@ func GetMessageService() *MessageService {
 		producer:      produce,
 		kafkaConsumer: consume,
 		redisRepo:     redisrepo,
-		esRepo:        elasticrepo,
+		indexer:       newSMSIndexer(elasticrepo, sqlrepo),
+		tenants:       newTenantService(sqlrepo),
 	}
+	go msg.HandleDeliveryReports(service.producer, service.handleDeliveryReport)
 	go service.StartConsumingMessages()
 	return service
 }
 
-var now time.Time
-
 func (s *MessageService) CreateMessage(sms *models.SMS) error {
-	now = time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+	now := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
 	sms.CreatedAt = now
 	sms.UpdatedAt = now
+	key, err := messageKey(sms)
+	if err != nil {
+		log.Printf("CreateMessage: %v", err)
+		return err
+	}
 	if err := s.db.Create(sms); err != nil {
 		log.Printf("CreateMessage: %s: %v", ErrCreateSMSDB, err)
 		return fmt.Errorf("%s: %w", ErrCreateSMSDB, err)
 	}
-	topic := "SMS"
-	err := s.producer.Produce(&kafka.Message{
-		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
-		Value:          []byte(sms.ID),
-	}, nil)
-
-	if err != nil {
+	// Searchable from the start; processing only updates the status
+	s.indexSmsInElasticsearch(*sms, now)
+	if err := s.produceSMS(sms.ID, key, 0); err != nil {
 		log.Printf("CreateMessage: %s: %v", ErrProduceKafka, err)
-		return fmt.Errorf("%s: %w", ErrProduceKafka, err)
+		return unavailable(ErrProduceKafka, err)
 	}
 
 	log.Printf("CreateMessage: Successfully created SMS with ID %s and sent to Kafka", sms.ID)
@@ -99,6 +157,174 @@ func (s *MessageService) CreateMessage(sms *models.SMS) error {
 	return nil
 }
 
+// messageKey returns the Kafka key for an SMS: the caller supplied ordering key
+// if there is one, otherwise the normalized phone number. All messages with the
+// same key land on the same partition and are consumed in order.
+func messageKey(sms *models.SMS) (string, error) {
+	if sms.OrderingKey != "" {
+		return sms.OrderingKey, nil
+	}
+	return NormalizePhoneNumber(sms.PhoneNumber)
+}
+
+// produceSMS enqueues the SMS ID on the Kafka topic under the given key, unless
+// the service is shutting down. While a retry of the key is pending the SMS is
+// held back and produced right after it, to keep the key's order.
+func (s *MessageService) produceSMS(id, key string, attempt int) error {
+	if s.closed.Load() {
+		return fmt.Errorf("%w: %s", ErrUnavailable, ErrProducerClosed)
+	}
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+	if pending := s.retries[key]; pending != nil {
+		pending.messages = append(pending.messages, retryMessage{id: id, attempt: attempt})
+		return nil
+	}
+	return s.produce(id, key, attempt)
+}
+
+// produce enqueues the SMS ID on the Kafka topic under the given key. The
+// attempt number travels as the message's opaque value so the delivery report
+// handler knows how many times the message has already been retried.
+func (s *MessageService) produce(id, key string, attempt int) error {
+	s.produceMu.RLock()
+	defer s.produceMu.RUnlock()
+	if s.producerClosed {
+		return fmt.Errorf("%w: %s", ErrUnavailable, ErrProducerClosed)
+	}
+	topic := config.KafkaTopic
+	return s.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            []byte(key),
+		Value:          []byte(id),
+		Opaque:         attempt,
+	}, nil)
+}
+
+// handleDeliveryReport is called for every delivery report from the producer.
+// Failed deliveries are marked in MySQL and retried with a linear backoff until
+// KafkaMaxDeliveryRetries is reached.
+func (s *MessageService) handleDeliveryReport(m *msg.Message) {
+	id := string(m.Value)
+	key := string(m.Key)
+	attempt, _ := m.Opaque.(int)
+
+	if m.TopicPartition.Error == nil {
+		if attempt > 0 {
+			if err := s.updateSMSStatus(id, StatusQueued, "Delivered to Kafka after retry"); err != nil {
+				log.Printf("handleDeliveryReport: %s for %s: %v", ErrUpdateSMSStatus, id, err)
+			}
+		}
+		return
+	}
+
+	deliveryErr := m.TopicPartition.Error
+	log.Printf("handleDeliveryReport: %s for %s (attempt %d): %v", ErrDeliveryKafka, id, attempt+1, deliveryErr)
+	comments := fmt.Sprintf("%s: %v", ErrDeliveryKafka, deliveryErr)
+	if err := s.updateSMSStatus(id, StatusDeliveryFailed, comments); err != nil {
+		log.Printf("handleDeliveryReport: %s for %s: %v", ErrUpdateSMSStatus, id, err)
+	}
+
+	if attempt >= config.KafkaMaxDeliveryRetries {
+		log.Printf("handleDeliveryReport: giving up on %s after %d attempts", id, attempt+1)
+		return
+	}
+	s.scheduleRetry(id, key, attempt+1)
+}
+
+// scheduleRetry produces the SMS again after a linear backoff, holding back
+// the later messages of its key until then. Once Close has started no retry is
+// scheduled any more; the SMS stays DeliveryFailed in MySQL, where a replay
+// can pick it up.
+func (s *MessageService) scheduleRetry(id, key string, attempt int) {
+	s.retryMu.Lock()
+	if s.closed.Load() {
+		s.retryMu.Unlock()
+		s.abandonRetry(id, "producer shut down")
+		return
+	}
+	message := retryMessage{id: id, attempt: attempt}
+	if pending := s.retries[key]; pending != nil {
+		// Another message of the key failed before; this one was produced
+		// earlier than those held back since, so it goes ahead of them
+		pending.messages = append(pending.messages[:pending.failed], append([]retryMessage{message}, pending.messages[pending.failed:]...)...)
+		pending.failed++
+		s.retryMu.Unlock()
+		return
+	}
+	if s.retries == nil {
+		s.retries = make(map[string]*pendingRetry)
+	}
+	s.retries[key] = &pendingRetry{
+		failed:   1,
+		messages: []retryMessage{message},
+		timer:    time.AfterFunc(time.Duration(attempt)*config.KafkaRetryBackoff, func() { s.retry(key) }),
+	}
+	s.retryMu.Unlock()
+}
+
+// retry sends the pending retry of the key when its backoff is over, unless
+// Close already took it.
+func (s *MessageService) retry(key string) {
+	s.retryMu.Lock()
+	defer s.retryMu.Unlock()
+	if pending, ok := s.retries[key]; ok {
+		delete(s.retries, key)
+		s.sendRetry(key, pending)
+	}
+}
+
+// sendRetry produces the messages of a pending retry in order. It is called
+// with retryMu held, so no new message of the key can slip in between. A
+// message that can't be produced is recorded on the SMS in MySQL instead of
+// being dropped.
+func (s *MessageService) sendRetry(key string, pending *pendingRetry) {
+	for _, m := range pending.messages {
+		if err := s.produce(m.id, key, m.attempt); err != nil {
+			log.Printf("handleDeliveryReport: %s for %s on retry: %v", ErrProduceKafka, m.id, err)
+			s.abandonRetry(m.id, err.Error())
+		}
+	}
+}
+
+// abandonRetry marks the SMS as DeliveryFailed with the reason its retry was
+// not sent.
+func (s *MessageService) abandonRetry(id, reason string) {
+	log.Printf("handleDeliveryReport: Not retrying %s: %s", id, reason)
+	comments := fmt.Sprintf("%s, retry not sent: %s", ErrDeliveryKafka, reason)
+	if err := s.updateSMSStatus(id, StatusDeliveryFailed, comments); err != nil {
+		log.Printf("handleDeliveryReport: %s for %s: %v", ErrUpdateSMSStatus, id, err)
+	}
+}
+
+// Close stops accepting SMS, sends the retries still waiting out their backoff
+// right away and flushes every message queued in the producer, so accepted SMS
+// are not dropped on shutdown. Then it closes the producer.
+func (s *MessageService) Close() {
+	if !s.closed.CompareAndSwap(false, true) {
+		return
+	}
+	s.retryMu.Lock()
+	for key, pending := range s.retries {
+		pending.timer.Stop()
+		s.sendRetry(key, pending)
+	}
+	s.retries = nil
+	s.retryMu.Unlock()
+
+	remaining := s.producer.Flush(config.KafkaFlushTimeoutMs)
+	if remaining > 0 {
+		log.Printf("Close: %d messages were not delivered to Kafka before the flush timeout", remaining)
+	} else {
+		log.Println("Close: Kafka producer flushed successfully")
+	}
+	s.produceMu.Lock()
+	s.producerClosed = true
+	s.producer.Close()
+	s.produceMu.Unlock()
+	s.indexer.Close()
+}
+
 func (s *MessageService) StartConsumingMessages() {
 	topic := config.KafkaTopic
 	err := s.kafkaConsumer.SubscribeTopics([]string{topic}, nil)
@@ -112,17 +338,18 @@ func (s *MessageService) StartConsumingMessages() {
 			continue
 		}
 
+		queued := queuedMessage{ID: string(msg.Value), Key: string(msg.Key)}
 		if s.queueSwitch  {
-			s.incomingQueue = append(s.incomingQueue, string(msg.Value))
+			s.incomingQueue = append(s.incomingQueue, queued)
 		} else {
-			s.processingQueue = append(s.processingQueue, string(msg.Value))
+			s.processingQueue = append(s.processingQueue, queued)
 		}
 		log.Printf("StartConsumingMessages: Message received from Kafka and added to queue: %s", msg.Value)
 	}
 }
 func (s *MessageService) ProcessMessages() ([]map[string]interface{}, error) {
 	s.queueSwitch =!s.queueSwitch
-	var messages []string
+	var messages []queuedMessage
 
 	// Check the current queueSwitch value atomically
 	if s.queueSwitch {
@@ -139,19 +366,52 @@ func (s *MessageService) ProcessMessages() ([]map[string]interface{}, error) {
 	}
 
 	log.Printf("ProcessMessages: Processing %d messages", len(messages))
-	var results []map[string]interface{}
-	for _, msgID := range messages {
-		result, err := s.processMessage(msgID)
-		if err != nil {
-			return nil, err
-		}
-		results = append(results, result)
-	}
+	results := s.processInParallel(messages)
 
 	log.Println("ProcessMessages: Message processing complete")
 	return results, nil
 }
 
+// processInParallel spreads messages over MessageProcessingWorkers workers by
+// hashing their key, so messages for the same recipient are still processed
+// one after another in consumption order. Results keep the input order; a
+// message that fails gets an error result and doesn't stop the others, whose
+// side effects are already done anyway.
+func (s *MessageService) processInParallel(messages []queuedMessage) []map[string]interface{} {
+	shards := make([][]int, config.MessageProcessingWorkers)
+	for i, m := range messages {
+		shard := shardForKey(m.Key, len(shards))
+		shards[shard] = append(shards[shard], i)
+	}
+
+	results := make([]map[string]interface{}, len(messages))
+	var wg sync.WaitGroup
+	for _, indexes := range shards {
+		if len(indexes) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+			for _, i := range indexes {
+				result, err := s.processMessage(messages[i].ID)
+				if err != nil {
+					result = s.createProcessingErrorResponse(messages[i].ID, err)
+				}
+				results[i] = result
+			}
+		}(indexes)
+	}
+	wg.Wait()
+	return results
+}
+
+func shardForKey(key string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
+
 func (s *MessageService) createNoMessagesResponse() []map[string]interface{} {
 	return []map[string]interface{}{
 		{"data": map[string]string{"comments": ErrNoMessages}},
@@ -173,7 +433,7 @@ func (s *MessageService) processMessage(msgID string) (map[string]interface{}, e
 	}
 
 	ctx := context.Background()
-	blacklist, err := s.checkBlacklistStatus(ctx, sms.PhoneNumber)
+	blacklist, err := s.checkBlacklistStatus(ctx, sms.TenantID, sms.PhoneNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -182,6 +442,17 @@ func (s *MessageService) processMessage(msgID string) (map[string]interface{}, e
 		return s.handleBlacklistedSms(sms)
 	}
 
+	if config.AllowlistMode {
+		allowed, err := isAllowlistedInCache(ctx, s.redisRepo, sms.TenantID, sms.PhoneNumber)
+		if err != nil {
+			log.Printf("processMessage: %s for %s: %v", ErrAllowlistCheck, sms.PhoneNumber, err)
+			return nil, fmt.Errorf("%s: %w", ErrAllowlistCheck, err)
+		}
+		if !allowed {
+			return s.handleNotAllowlistedSms(sms)
+		}
+	}
+
 	return s.handleSuccessfulSms(sms)
 }
 
@@ -196,6 +467,13 @@ func (s *MessageService) checkSmsExistence(msgID string) (bool, error) {
 	return exists, nil
 }
 
+func (s *MessageService) createProcessingErrorResponse(msgID string, err error) map[string]interface{} {
+	log.Printf("processMessage: Failed to process %s: %v", msgID, err)
+	return map[string]interface{}{
+		"error": map[string]string{"id": msgID, "comments": err.Error()},
+	}
+}
+
 func (s *MessageService) createSmsNotFoundResponse(msgID string) map[string]interface{} {
 	return map[string]interface{}{
 		"error": map[string]string{"comments": msgID},
@@ -204,7 +482,7 @@ func (s *MessageService) createSmsNotFoundResponse(msgID string) map[string]inte
 
 func (s *MessageService) retrieveSmsDetails(msgID string) (models.SMS, error) {
 	var sms models.SMS
-	query := `SELECT id, phone_number, message FROM sms WHERE id = ?`
+	query := `SELECT id, phone_number, message, failure_code, tenant_id, sender_id, created_at FROM sms WHERE id = ?`
 	err := s.db.Raw(query, msgID).Scan(&sms).Error
 	if err != nil {
 		log.Printf("retrieveSmsDetails: %s for %s: %v", ErrRetrieveSMSDetails, msgID, err)
@@ -213,73 +491,105 @@ func (s *MessageService) retrieveSmsDetails(msgID string) (models.SMS, error) {
 	return sms, nil
 }
 
-func (s *MessageService) checkBlacklistStatus(ctx context.Context, phoneNumber string) (bool, error) {
-	blacklist, err := s.redisRepo.SIsMember(ctx, "Black", phoneNumber).Result()
+// IsBlacklisted reports whether SMS to the number are blocked for the tenant,
+// by an exact entry or a rule.
+func (s *MessageService) IsBlacklisted(tenantID, phoneNumber string) (bool, error) {
+	return s.checkBlacklistStatus(context.Background(), tenantID, phoneNumber)
+}
+
+func (s *MessageService) checkBlacklistStatus(ctx context.Context, tenantID, phoneNumber string) (bool, error) {
+	phoneNumber = lookupPhoneNumber(phoneNumber)
+	blacklist, listed, err := isBlockedInCache(ctx, s.redisRepo, tenantID, phoneNumber)
 	if err != nil {
 		log.Printf("checkBlacklistStatus: %s for %s: %v", ErrBlacklistCheck, phoneNumber, err)
-		return false, fmt.Errorf("%s: %w", ErrBlacklistCheck, err)
+		return false, unavailable(ErrBlacklistCheck, err)
+	}
+	if blacklist {
+		recordBlacklistHit(ctx, s.redisRepo, tenantID, phoneNumber, listed)
 	}
 	return blacklist, nil
 }
 
 func (s *MessageService) handleBlacklistedSms(sms models.SMS) (map[string]interface{}, error) {
-	sms.Status = "Failed"
+	sms.Status = StatusFailed
 	sms.FailureComments = "Blacklisted number"
-	err := s.db.UpdateSMSStatus(sms.ID, sms.Status, sms.FailureComments)
-	if err != nil {
+	if err := s.updateSMSStatus(sms.ID, sms.Status, sms.FailureComments); err != nil {
 		log.Printf("handleBlacklistedSms: %s for %s: %v", ErrUpdateSMSStatus, sms.ID, err)
 		return nil, fmt.Errorf("%s: %w", ErrUpdateSMSStatus, err)
 	}
 
-	err = s.indexSmsInElasticsearch(sms)
-	if err != nil {
-		log.Printf("handleBlacklistedSms: %s for %s: %v", ErrIndexElasticsearch, sms.ID, err)
-		return nil, fmt.Errorf("%s: %w", ErrIndexElasticsearch, err)
-	}
-
+	s.tenants.NotifyStatus(sms)
 	log.Printf("handleBlacklistedSms: SMS ID %s is blacklisted", sms.ID)
 	return map[string]interface{}{
 		"data": map[string]string{"comments": "Blacklisted number"},
 	}, nil
 }
 
+func (s *MessageService) handleNotAllowlistedSms(sms models.SMS) (map[string]interface{}, error) {
+	sms.Status = StatusNotAllowlisted
+	sms.FailureComments = "Number is not allowlisted"
+	if err := s.updateSMSStatus(sms.ID, sms.Status, sms.FailureComments); err != nil {
+		log.Printf("handleNotAllowlistedSms: %s for %s: %v", ErrUpdateSMSStatus, sms.ID, err)
+		return nil, fmt.Errorf("%s: %w", ErrUpdateSMSStatus, err)
+	}
+
+	s.tenants.NotifyStatus(sms)
+	log.Printf("handleNotAllowlistedSms: SMS ID %s is not allowlisted", sms.ID)
+	return map[string]interface{}{
+		"data": map[string]string{"comments": "Number is not allowlisted"},
+	}, nil
+}
+
 func (s *MessageService) handleSuccessfulSms(sms models.SMS) (map[string]interface{}, error) {
-	sms.Status = "Successful"
+	sms.Status = StatusSuccessful
 	sms.FailureComments = "No failure comments"
-	err := s.db.UpdateSMSStatus(sms.ID, sms.Status, sms.FailureComments)
-	if err != nil {
+	if err := s.updateSMSStatus(sms.ID, sms.Status, sms.FailureComments); err != nil {
 		log.Printf("handleSuccessfulSms: %s for %s: %v", ErrUpdateSMSStatus, sms.ID, err)
 		return nil, fmt.Errorf("%s: %w", ErrUpdateSMSStatus, err)
 	}
 
-	err = s.indexSmsInElasticsearch(sms)
-	if err != nil {
-		log.Printf("handleSuccessfulSms: %s for %s: %v", ErrIndexElasticsearch, sms.ID, err)
-		return nil, fmt.Errorf("%s: %w", ErrIndexElasticsearch, err)
-	}
-
+	s.tenants.NotifyStatus(sms)
 	log.Printf("handleSuccessfulSms: SMS ID %s processed successfully", sms.ID)
 	return map[string]interface{}{
 		"data": map[string]string{"comments": "Successfully processed"},
 	}, nil
 }
 
-func (s *MessageService) indexSmsInElasticsearch(sms models.SMS) error {
-	t := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
-	dur := t.Sub(now)
-	err := s.esRepo.CreateIndexSMS(sms, dur)
+// indexSmsInElasticsearch queues the SMS, last changed at updatedAt, for
+// indexing. Indexing happens in the background, so Elasticsearch never delays
+// or fails processing.
+func (s *MessageService) indexSmsInElasticsearch(sms models.SMS, updatedAt time.Time) {
+	doc, err := repository.NewSMSDocument(sms, sms.CreatedAt, updatedAt)
+	if err != nil {
+		log.Printf("indexSmsInElasticsearch: %s for %s: %v", ErrIndexElasticsearch, sms.ID, err)
+		return
+	}
+	s.indexer.Enqueue(doc)
+}
+
+// updateSMSStatus changes the status of the SMS in MySQL and sends the change
+// to Elasticsearch as a partial update of the indexed document, so both agree
+// on the current status and update time.
+func (s *MessageService) updateSMSStatus(id, status, failureComments string) error {
+	updatedAt := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+	if err := s.db.UpdateSMSStatus(id, status, failureComments, updatedAt); err != nil {
+		return err
+	}
+	update, err := repository.NewSMSStatusUpdate(id, status, failureComments, updatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to index SMS in Elasticsearch: %w", err)
+		log.Printf("updateSMSStatus: %s for %s: %v", ErrIndexElasticsearch, id, err)
+		return nil
 	}
+	s.indexer.Enqueue(update)
 	return nil
 }
 
-func (s *MessageService) CheckIDExists(msgID string) (bool, error) {
+func (s *MessageService) CheckIDExists(tenantID, msgID string) (bool, error) {
 	var exists bool
 
-	// Query to check if the SMS ID exists
-	existQuery := `SELECT EXISTS(SELECT 1 FROM sms WHERE id = ?)`
-	err := s.db.Raw(existQuery, msgID).Row().Scan(&exists)
+	// Query to check if the SMS ID exists for the tenant
+	existQuery := `SELECT EXISTS(SELECT 1 FROM sms WHERE id = ? AND tenant_id = ?)`
+	err := s.db.Raw(existQuery, msgID, tenantID).Row().Scan(&exists)
 	if err != nil {
 		log.Printf("CheckIDExists: Failed to check ID existence for %s: %v", msgID, err)
 		return false, fmt.Errorf("failed to check ID existence: %w", err)
@@ -288,10 +598,10 @@ func (s *MessageService) CheckIDExists(msgID string) (bool, error) {
 	return exists, nil
 }
 
-func (s *MessageService) GetAllMessages() ([]models.SMS, error) {
-	query := `SELECT id, phone_number, message, status, failure_code, failure_comments, created_at, updated_at FROM sms`
+func (s *MessageService) GetAllMessages(tenantID string) ([]models.SMS, error) {
+	query := `SELECT id, phone_number, message, status, failure_code, failure_comments, tenant_id, sender_id, created_at, updated_at FROM sms WHERE tenant_id = ?`
 
-	rows, err := s.db.Raw(query).Rows()
+	rows, err := s.db.Raw(query, tenantID).Rows()
 	if err != nil {
 		log.Printf("GetAllMessages: Failed to retrieve SMS details: %v", err)
 		return nil, fmt.Errorf("failed to retrieve SMS details: %w", err)
@@ -301,75 +611,40 @@ func (s *MessageService) GetAllMessages() ([]models.SMS, error) {
 	var result []models.SMS
 	for rows.Next() {
 		var sms models.SMS
-		var createdAt, updatedAt []uint8
 
-		if err := rows.Scan(&sms.ID, &sms.PhoneNumber, &sms.Message, &sms.Status, &sms.FailureCode, &sms.FailureComments, &createdAt, &updatedAt); err != nil {
+		if err := rows.Scan(&sms.ID, &sms.PhoneNumber, &sms.Message, &sms.Status, &sms.FailureCode, &sms.FailureComments, &sms.TenantID, &sms.SenderID, &sms.CreatedAt, &sms.UpdatedAt); err != nil {
 			log.Printf("GetAllMessages: Error scanning row: %v", err)
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
 
-		parsedCreatedAt, parsedUpdatedAt, err := s.parseTimestamps(createdAt, updatedAt)
-		if err != nil {
-			log.Printf("GetAllMessages: %v", err)
-			return nil, err
-		}
-
-		sms.CreatedAt = parsedCreatedAt
-		sms.UpdatedAt = parsedUpdatedAt
-
 		result = append(result, sms)
 	}
 
 	return result, nil
 }
-func (s *MessageService) parseTimestamps(createdAt, updatedAt []uint8) (time.Time, time.Time, error) {
-	var parsedCreatedAt, parsedUpdatedAt time.Time
-
-	var err error
-	if len(createdAt) > 0 {
-		parsedCreatedAt, err = time.Parse("2006-01-02 15:04:05", string(createdAt))
-		if err != nil {
-			return time.Time{}, time.Time{}, fmt.Errorf("error parsing CreatedAt: %w", err)
-		}
-	}
-
-	if len(updatedAt) > 0 {
-		parsedUpdatedAt, err = time.Parse("2006-01-02 15:04:05", string(updatedAt))
-		if err != nil {
-			return time.Time{}, time.Time{}, fmt.Errorf("error parsing UpdatedAt: %w", err)
-		}
-	}
-
-	return parsedCreatedAt, parsedUpdatedAt, nil
-}
-func (s *MessageService) GetMessageByID(msgID string) (*models.SMS, error) {
+func (s *MessageService) GetMessageByID(tenantID, msgID string) (*models.SMS, error) {
 	var sms models.SMS
-	var createdAt, updatedAt []uint8
 
-	query := `SELECT id, phone_number, message, status, failure_code, failure_comments, created_at, updated_at FROM sms WHERE id = ?`
-	err := s.db.Raw(query, msgID).Row().Scan(
+	query := `SELECT id, phone_number, message, status, failure_code, failure_comments, tenant_id, sender_id, created_at, updated_at FROM sms WHERE id = ? AND tenant_id = ?`
+	err := s.db.Raw(query, msgID, tenantID).Row().Scan(
 		&sms.ID,
 		&sms.PhoneNumber,
 		&sms.Message,
 		&sms.Status,
 		&sms.FailureCode,
 		&sms.FailureComments,
-		&createdAt,
-		&updatedAt,
+		&sms.TenantID,
+		&sms.SenderID,
+		&sms.CreatedAt,
+		&sms.UpdatedAt,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: request_ID %s", ErrNotFound, msgID)
+	}
 	if err != nil {
 		log.Printf("GetMessageByID: Failed to retrieve SMS details for %s: %v", msgID, err)
 		return nil, fmt.Errorf("failed to retrieve SMS details: %w", err)
 	}
 
-	parsedCreatedAt, parsedUpdatedAt, err := s.parseTimestamps(createdAt, updatedAt)
-	if err != nil {
-		log.Printf("GetMessageByID: %v", err)
-		return nil, err
-	}
-
-	sms.CreatedAt = parsedCreatedAt
-	sms.UpdatedAt = parsedUpdatedAt
-
 	return &sms, nil
 }
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error Messages
+const (
+	ErrInvalidPhoneNumber = "invalid phone number"
+)
+
+// NormalizePhoneNumber strips formatting characters (spaces, dashes, dots and
+// brackets) from a phone number and checks that what remains is an optional
+// leading '+' followed by 7 to 15 digits.
+func NormalizePhoneNumber(number string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+			continue
+		default:
+			return "", fmt.Errorf("%w: %s: %q", ErrValidation, ErrInvalidPhoneNumber, number)
+		}
+	}
+
+	normalized := b.String()
+	digits := len(strings.TrimPrefix(normalized, "+"))
+	if digits < 7 || digits > 15 {
+		return "", fmt.Errorf("%w: %s: %q", ErrValidation, ErrInvalidPhoneNumber, number)
+	}
+	return normalized, nil
+}
+
+// lookupPhoneNumber returns the form number is looked up by in the blacklist
+// and the allowlist:
+// its normalized form, or number itself if it doesn't normalize, in which case
+// it can't match any stored entry.
+func lookupPhoneNumber(number string) string {
+	if normalized, err := NormalizePhoneNumber(number); err == nil {
+		return normalized
+	}
+	return number
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"notifications/internal/models"
+)
+
+// Replay job statuses
+const (
+	ReplayRunning   = "Running"
+	ReplayCompleted = "Completed"
+	ReplayFailed    = "Failed"
+)
+
+// Error Messages
+const (
+	ErrEmptyReplayFilter = "replay filter must set a status, a time range or IDs"
+)
+
+// ReplayFilter selects the messages a replay job re-queues. Every non-empty
+// field must match. TenantID comes from the caller, not the request body.
+type ReplayFilter struct {
+	TenantID  string    `json:"-"`
+	Status    string    `json:"status"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	IDs       []string  `json:"ids"`
+}
+
+// IsEmpty reports whether the filter would match every message of the tenant.
+func (f ReplayFilter) IsEmpty() bool {
+	return f.Status == "" && f.StartTime.IsZero() && f.EndTime.IsZero() && len(f.IDs) == 0
+}
+
+// ReplayJob reports the progress of a replay run.
+type ReplayJob struct {
+	ID        string       `json:"jobID"`
+	Filter    ReplayFilter `json:"filter"`
+	Status    string       `json:"status"`
+	Total     int          `json:"total"`
+	Requeued  int          `json:"requeued"`
+	Failed    int          `json:"failed"`
+	Error     string       `json:"error,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// replayJobs keeps every replay job started by this process.
+type replayJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*ReplayJob
+}
+
+func (j *replayJobs) update(id string, fn func(job *ReplayJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := j.jobs[id]
+	fn(job)
+	job.UpdatedAt = time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+}
+
+// StartReplay creates a replay job for the messages matching filter and runs
+// it in the background. The returned job is a snapshot; poll GetReplayJob for
+// progress.
+func (s *MessageService) StartReplay(filter ReplayFilter) (ReplayJob, error) {
+	if filter.IsEmpty() {
+		return ReplayJob{}, fmt.Errorf("%w: %s", ErrValidation, ErrEmptyReplayFilter)
+	}
+
+	now := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+	job := &ReplayJob{
+		ID:        fmt.Sprintf("replay-%d", time.Now().UnixNano()),
+		Filter:    filter,
+		Status:    ReplayRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.replays.mu.Lock()
+	if s.replays.jobs == nil {
+		s.replays.jobs = make(map[string]*ReplayJob)
+	}
+	s.replays.jobs[job.ID] = job
+	snapshot := *job
+	s.replays.mu.Unlock()
+
+	go s.runReplay(job.ID, filter)
+	log.Printf("StartReplay: Started replay job %s", job.ID)
+	return snapshot, nil
+}
+
+// GetReplayJob returns the current state of the tenant's replay job, or
+// ErrNotFound if the tenant has no job with that ID.
+func (s *MessageService) GetReplayJob(tenantID, id string) (ReplayJob, error) {
+	s.replays.mu.Lock()
+	defer s.replays.mu.Unlock()
+	job, ok := s.replays.jobs[id]
+	if !ok || job.Filter.TenantID != tenantID {
+		return ReplayJob{}, fmt.Errorf("%w: replay job %s", ErrNotFound, id)
+	}
+	return *job, nil
+}
+
+// runReplay resets the status of every matching message and produces it to
+// Kafka again under its original ID and key.
+func (s *MessageService) runReplay(jobID string, filter ReplayFilter) {
+	smsList, err := s.db.FindSMS(filter.TenantID, filter.Status, filter.StartTime, filter.EndTime, filter.IDs)
+	if err != nil {
+		log.Printf("runReplay: %s: %v", jobID, err)
+		s.replays.update(jobID, func(job *ReplayJob) {
+			job.Status = ReplayFailed
+			job.Error = err.Error()
+		})
+		return
+	}
+	s.replays.update(jobID, func(job *ReplayJob) { job.Total = len(smsList) })
+
+	for i := range smsList {
+		sms := &smsList[i]
+		err := s.replayMessage(jobID, sms)
+		if err != nil {
+			log.Printf("runReplay: %s: failed to re-queue %s: %v", jobID, sms.ID, err)
+		}
+		s.replays.update(jobID, func(job *ReplayJob) {
+			if err != nil {
+				job.Failed++
+			} else {
+				job.Requeued++
+			}
+		})
+	}
+
+	s.replays.update(jobID, func(job *ReplayJob) { job.Status = ReplayCompleted })
+	log.Printf("runReplay: Replay job %s completed for %d messages", jobID, len(smsList))
+}
+
+func (s *MessageService) replayMessage(jobID string, sms *models.SMS) error {
+	key, err := messageKey(sms)
+	if err != nil {
+		return err
+	}
+	if err := s.updateSMSStatus(sms.ID, StatusQueued, "Re-queued by "+jobID); err != nil {
+		return fmt.Errorf("%s: %w", ErrUpdateSMSStatus, err)
+	}
+	if err := s.produceSMS(sms.ID, key, 0); err != nil {
+		return fmt.Errorf("%s: %w", ErrProduceKafka, err)
+	}
+	return nil
+}
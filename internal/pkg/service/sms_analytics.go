@@ -0,0 +1,262 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"notifications/internal/pkg/repository"
+)
+
+// Histogram intervals of the SMS analytics
+const (
+	IntervalHour  = "hour"
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Error Messages
+const (
+	ErrInvalidInterval = "interval must be one of hour, day, week, month"
+	ErrTooManyBuckets  = "time range has too many intervals"
+)
+
+const (
+	// Range analysed when the request has none
+	defaultAnalyticsRange = 7 * 24 * time.Hour
+	// Most histogram buckets one request may produce
+	maxAnalyticsBuckets = 1000
+	// Most failure reasons reported
+	maxFailureReasons = 20
+	// Most statuses counted, well above the number of statuses there are so
+	// none is ever left out
+	maxStatusCounts = 50
+)
+
+// analyticsIntervals holds the approximate length of each interval, used to
+// bound the number of histogram buckets.
+var analyticsIntervals = map[string]time.Duration{
+	IntervalHour:  time.Hour,
+	IntervalDay:   24 * time.Hour,
+	IntervalWeek:  7 * 24 * time.Hour,
+	IntervalMonth: 30 * 24 * time.Hour,
+}
+
+// failureStatuses are the statuses of SMS that were not delivered. SMS still
+// waiting to be processed, or queued again by a replay, are neither failed
+// nor delivered.
+var failureStatuses = []string{StatusFailed, StatusDeliveryFailed, StatusNotAllowlisted}
+
+// terminalStatuses are the statuses of SMS whose processing finished.
+var terminalStatuses = append([]string{StatusSuccessful}, failureStatuses...)
+
+// failuresFilter selects the SMS whose failure reasons are reported.
+func failuresFilter() Query {
+	return Terms("status", failureStatuses...)
+}
+
+// latencyFilter selects the SMS the latency is measured over; until it is
+// processed, an SMS was last updated when it was created.
+func latencyFilter() Query {
+	return Terms("status", terminalStatuses...)
+}
+
+// smsLatencyScript emits the milliseconds between creation and the last update
+// of an SMS, for documents that have both.
+const smsLatencyScript = `if (doc['created_at'].size() > 0 && doc['updated_at'].size() > 0) {
+	emit(doc['updated_at'].value.toInstant().toEpochMilli() - doc['created_at'].value.toInstant().toEpochMilli());
+}`
+
+// SMSAnalyticsRequest selects the SMS an analytics report covers. A zero To
+// is now and a zero From is a week before To; Interval defaults to a day.
+type SMSAnalyticsRequest struct {
+	TenantID      string
+	From          time.Time
+	To            time.Time
+	Interval      string
+	TopRecipients int
+}
+
+// StatusBucket counts the SMS created in one interval, per status.
+type StatusBucket struct {
+	Start    string           `json:"start"`
+	Total    int64            `json:"total"`
+	ByStatus map[string]int64 `json:"by_status"`
+}
+
+// TermCount is how many SMS share a value.
+type TermCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// LatencyPercentiles are milliseconds between creation and the last update of
+// the processed SMS. They are nil when no SMS was processed.
+type LatencyPercentiles struct {
+	P50Ms *float64 `json:"p50_ms"`
+	P95Ms *float64 `json:"p95_ms"`
+}
+
+// SMSAnalytics is the delivery report of a time range.
+type SMSAnalytics struct {
+	From           time.Time          `json:"from"`
+	To             time.Time          `json:"to"`
+	Interval       string             `json:"interval"`
+	Total          int64              `json:"total"`
+	Histogram      []StatusBucket     `json:"histogram"`
+	FailureReasons []TermCount        `json:"failure_reasons"`
+	TopRecipients  []TermCount        `json:"top_recipients"`
+	Latency        LatencyPercentiles `json:"latency"`
+}
+
+type termsAggregation struct {
+	Buckets []struct {
+		Key      string `json:"key"`
+		DocCount int64  `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+func (t termsAggregation) counts() []TermCount {
+	counts := make([]TermCount, 0, len(t.Buckets))
+	for _, bucket := range t.Buckets {
+		counts = append(counts, TermCount{Value: bucket.Key, Count: bucket.DocCount})
+	}
+	return counts
+}
+
+// SMSAnalytics reports the SMS created in the requested range: counts per
+// interval and status, failure reasons, top recipients and delivery latency.
+func (e *ElasticsearchService) SMSAnalytics(request SMSAnalyticsRequest) (*SMSAnalytics, error) {
+	if request.Interval == "" {
+		request.Interval = IntervalDay
+	}
+	interval, ok := analyticsIntervals[request.Interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, ErrInvalidInterval)
+	}
+	if request.To.IsZero() {
+		request.To = time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+	}
+	if request.From.IsZero() {
+		request.From = request.To.Add(-defaultAnalyticsRange)
+	}
+	if request.From.After(request.To) {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, ErrInvalidTimeRange)
+	}
+	if request.To.Sub(request.From)/interval >= maxAnalyticsBuckets {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, ErrTooManyBuckets)
+	}
+	if request.TopRecipients <= 0 {
+		return nil, fmt.Errorf("%w: top recipients must be positive", ErrValidation)
+	}
+
+	from := request.From.Format(time.RFC3339)
+	to := request.To.Format(time.RFC3339)
+	body := smsAnalyticsBody(request)
+
+	var response struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			OverTime struct {
+				Buckets []struct {
+					KeyAsString string           `json:"key_as_string"`
+					DocCount    int64            `json:"doc_count"`
+					ByStatus    termsAggregation `json:"by_status"`
+				} `json:"buckets"`
+			} `json:"over_time"`
+			Failures struct {
+				Reasons termsAggregation `json:"reasons"`
+			} `json:"failures"`
+			TopRecipients termsAggregation `json:"top_recipients"`
+			Latency       struct {
+				Percentiles struct {
+					Values map[string]*float64 `json:"values"`
+				} `json:"percentiles"`
+			} `json:"latency"`
+		} `json:"aggregations"`
+	}
+	index := repository.SMSIndexPattern(request.From, request.To)
+	if err := e.repo.Aggregate(index, body, &response); err != nil {
+		return nil, e.HandleError("SMSAnalytics", err, index)
+	}
+
+	analytics := &SMSAnalytics{
+		From:           request.From,
+		To:             request.To,
+		Interval:       request.Interval,
+		Total:          response.Hits.Total.Value,
+		Histogram:      make([]StatusBucket, 0, len(response.Aggregations.OverTime.Buckets)),
+		FailureReasons: response.Aggregations.Failures.Reasons.counts(),
+		TopRecipients:  response.Aggregations.TopRecipients.counts(),
+		Latency: LatencyPercentiles{
+			P50Ms: response.Aggregations.Latency.Percentiles.Values["50.0"],
+			P95Ms: response.Aggregations.Latency.Percentiles.Values["95.0"],
+		},
+	}
+	for _, bucket := range response.Aggregations.OverTime.Buckets {
+		byStatus := make(map[string]int64, len(bucket.ByStatus.Buckets))
+		for _, status := range bucket.ByStatus.counts() {
+			byStatus[status.Value] = status.Count
+		}
+		analytics.Histogram = append(analytics.Histogram, StatusBucket{Start: bucket.KeyAsString, Total: bucket.DocCount, ByStatus: byStatus})
+	}
+
+	log.Printf("SMSAnalytics: Analysed %d documents of tenant %s between %s and %s", analytics.Total, request.TenantID, from, to)
+	return analytics, nil
+}
+
+// smsAnalyticsBody returns the search request of an analytics report.
+func smsAnalyticsBody(request SMSAnalyticsRequest) map[string]interface{} {
+	from := request.From.Format(time.RFC3339)
+	to := request.To.Format(time.RFC3339)
+	return map[string]interface{}{
+		"query":            tenantQuery(request.TenantID, DateRange("created_at", request.From, request.To)),
+		"track_total_hits": true,
+		"runtime_mappings": map[string]interface{}{
+			"latency_ms": map[string]interface{}{
+				"type":   "long",
+				"script": map[string]string{"source": smsLatencyScript},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"over_time": map[string]interface{}{
+				"date_histogram": map[string]interface{}{
+					"field":             "created_at",
+					"calendar_interval": request.Interval,
+					"format":            DateFormat,
+					"min_doc_count":     0,
+					"extended_bounds":   map[string]string{"min": from, "max": to},
+				},
+				"aggs": map[string]interface{}{
+					"by_status": map[string]interface{}{
+						"terms": map[string]interface{}{"field": "status", "size": maxStatusCounts},
+					},
+				},
+			},
+			"failures": map[string]interface{}{
+				"filter": failuresFilter(),
+				"aggs": map[string]interface{}{
+					"reasons": map[string]interface{}{
+						"terms": map[string]interface{}{"field": "failure_comments.keyword", "size": maxFailureReasons},
+					},
+				},
+			},
+			"top_recipients": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "phone_number", "size": request.TopRecipients},
+			},
+			"latency": map[string]interface{}{
+				"filter": latencyFilter(),
+				"aggs": map[string]interface{}{
+					"percentiles": map[string]interface{}{
+						"percentiles": map[string]interface{}{"field": "latency_ms", "percents": []float64{50, 95}},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// analyticsFixture holds SMS in every stage: pending SMS are indexed with no
+// status at creation, and replays queue SMS again.
+var analyticsFixture = []map[string]interface{}{
+	{"status": "", "failure_comments": "", "latency_ms": 0},
+	{"status": "", "failure_comments": "", "latency_ms": 0},
+	{"status": StatusQueued, "failure_comments": "Re-queued by replay-1", "latency_ms": 0},
+	{"status": StatusSuccessful, "failure_comments": "No failure comments", "latency_ms": 120},
+	{"status": StatusSuccessful, "failure_comments": "No failure comments", "latency_ms": 80},
+	{"status": StatusFailed, "failure_comments": "Blacklisted number", "latency_ms": 40},
+	{"status": StatusDeliveryFailed, "failure_comments": "Broker unreachable", "latency_ms": 3000},
+	{"status": StatusNotAllowlisted, "failure_comments": "Number is not allowlisted", "latency_ms": 20},
+}
+
+// matches evaluates the term, terms and bool clauses the analytics filters are
+// built from against a fixture document, the way Elasticsearch would.
+func matches(t *testing.T, clause map[string]interface{}, doc map[string]interface{}) bool {
+	t.Helper()
+	if len(clause) != 1 {
+		t.Fatalf("clause %v must have exactly one type", clause)
+	}
+	for kind, body := range clause {
+		fields, _ := body.(map[string]interface{})
+		switch kind {
+		case "term":
+			for field, value := range fields {
+				return doc[field] == value
+			}
+		case "terms":
+			for field, values := range fields {
+				for _, value := range values.([]interface{}) {
+					if doc[field] == value {
+						return true
+					}
+				}
+				return false
+			}
+		case "bool":
+			for occur, clauses := range fields {
+				for _, c := range clauses.([]interface{}) {
+					matched := matches(t, c.(map[string]interface{}), doc)
+					if (occur == "must_not") == matched {
+						return false
+					}
+				}
+			}
+			return true
+		default:
+			t.Fatalf("unsupported clause %s", kind)
+		}
+	}
+	return false
+}
+
+// aggregationFilter returns the filter of a top level aggregation of the
+// analytics request, as sent to Elasticsearch.
+func aggregationFilter(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+	body, err := json.Marshal(smsAnalyticsBody(SMSAnalyticsRequest{
+		TenantID:      "tenant",
+		From:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:            time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		Interval:      IntervalDay,
+		TopRecipients: 10,
+	}))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var request struct {
+		Aggs map[string]struct {
+			Filter map[string]interface{} `json:"filter"`
+		} `json:"aggs"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	filter := request.Aggs[name].Filter
+	if filter == nil {
+		t.Fatalf("aggregation %s has no filter in %s", name, body)
+	}
+	return filter
+}
+
+func TestFailureReasonsLeaveOutPendingSMS(t *testing.T) {
+	filter := aggregationFilter(t, "failures")
+
+	var reasons []string
+	for _, doc := range analyticsFixture {
+		if matches(t, filter, doc) {
+			reasons = append(reasons, doc["failure_comments"].(string))
+		}
+	}
+	sort.Strings(reasons)
+
+	want := []string{"Blacklisted number", "Broker unreachable", "Number is not allowlisted"}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("failure reasons = %q, want %q", reasons, want)
+	}
+}
+
+func TestLatencyLeavesOutUnprocessedSMS(t *testing.T) {
+	filter := aggregationFilter(t, "latency")
+
+	var latencies []int
+	for _, doc := range analyticsFixture {
+		if matches(t, filter, doc) {
+			latencies = append(latencies, doc["latency_ms"].(int))
+		}
+	}
+	sort.Ints(latencies)
+
+	want := []int{20, 40, 80, 120, 3000}
+	if !reflect.DeepEqual(latencies, want) {
+		t.Errorf("latencies = %v, want %v", latencies, want)
+	}
+}
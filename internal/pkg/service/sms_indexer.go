@@ -0,0 +1,268 @@
+package service
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	config "notifications/configurations"
+	"notifications/internal/models"
+	"notifications/internal/pkg/repository"
+)
+
+// SMSIndexer indexes SMS documents in Elasticsearch in the background, so a
+// slow or unavailable cluster never holds up or fails delivery. Documents are
+// queued in memory and sent in bulk batches; a batch that still fails after
+// the retries, or a document that doesn't fit in the queue, is stored in the
+// MySQL backlog and retried from there until Elasticsearch takes it.
+type SMSIndexer struct {
+	es     *repository.ElasticsearchRepo
+	db     *repository.MySQLRepo
+	queue  chan repository.SMSDocument
+	stop   chan struct{}
+	done   chan struct{}
+	closed atomic.Bool
+}
+
+func newSMSIndexer(es *repository.ElasticsearchRepo, db *repository.MySQLRepo) *SMSIndexer {
+	i := &SMSIndexer{
+		es:    es,
+		db:    db,
+		queue: make(chan repository.SMSDocument, config.ElasticsearchQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go i.run()
+	go i.drainBacklog()
+	return i
+}
+
+// Enqueue schedules the document for indexing. It never blocks: when the
+// queue is full or the indexer is closed the document goes to the backlog.
+func (i *SMSIndexer) Enqueue(doc repository.SMSDocument) {
+	if i.closed.Load() {
+		i.persist([]repository.SMSDocument{doc})
+		return
+	}
+	select {
+	case i.queue <- doc:
+	default:
+		log.Printf("Enqueue: Index queue full, storing document %s in the backlog", doc.ID)
+		i.persist([]repository.SMSDocument{doc})
+	}
+}
+
+// run sends queued documents in batches of up to ElasticsearchBulkSize, at
+// least every ElasticsearchFlushInterval.
+func (i *SMSIndexer) run() {
+	defer close(i.done)
+	ticker := time.NewTicker(config.ElasticsearchFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]repository.SMSDocument, 0, config.ElasticsearchBulkSize)
+	for {
+		select {
+		case doc := <-i.queue:
+			batch = append(batch, doc)
+			if len(batch) < config.ElasticsearchBulkSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-i.stop:
+			// Whatever is still queued is indexed once or kept in the backlog
+			for len(i.queue) > 0 {
+				batch = append(batch, <-i.queue)
+			}
+			i.flush(batch, 1)
+			return
+		}
+		i.flush(batch, config.ElasticsearchRetryAttempts)
+		batch = batch[:0]
+	}
+}
+
+// flush indexes the batch, retrying what fails with exponential backoff, and
+// stores what is left after the attempts in the backlog.
+func (i *SMSIndexer) flush(batch []repository.SMSDocument, attempts int) {
+	docs := batch
+	i.locate(docs)
+	backoff := config.ElasticsearchRetryBackoff
+	for attempt := 1; len(docs) > 0; attempt++ {
+		failed, err := i.es.BulkIndexSMS(docs)
+		if err != nil {
+			log.Printf("flush: Failed to index %d documents (attempt %d of %d): %v", len(docs), attempt, attempts, err)
+			failed = docs
+		}
+		docs = i.complete(failed)
+		if len(docs) == 0 || attempt >= attempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-i.stop:
+			attempts = attempt
+		}
+		backoff *= 2
+	}
+	i.persist(docs)
+}
+
+// locate points the status updates among docs at the index their SMS is
+// stored in, which may be an older period index than the write alias. Updates
+// of SMS that aren't searchable yet go to the write alias, the index of the
+// current period, where documents indexed moments ago live.
+func (i *SMSIndexer) locate(docs []repository.SMSDocument) {
+	var ids []string
+	for _, doc := range docs {
+		if doc.Partial && doc.Index == "" {
+			ids = append(ids, doc.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	indices, err := i.es.LocateSMS(ids)
+	if err != nil {
+		log.Printf("locate: Failed to look up the index of %d documents: %v", len(ids), err)
+		return
+	}
+	for n := range docs {
+		if docs[n].Partial && docs[n].Index == "" {
+			docs[n].Index = indices[docs[n].ID]
+		}
+	}
+}
+
+// complete replaces the status updates among docs with the full documents of
+// their SMS, read from MySQL, and returns the documents left to index. An
+// update fails for good if the SMS was never indexed, while the full document
+// carries the update along with the rest of the SMS. Updates of SMS that are
+// no longer in MySQL can never be indexed and are dropped; updates MySQL
+// can't be read for are kept as they are.
+func (i *SMSIndexer) complete(docs []repository.SMSDocument) []repository.SMSDocument {
+	var ids []string
+	for _, doc := range docs {
+		if doc.Partial {
+			ids = append(ids, doc.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return docs
+	}
+	smsList, err := i.db.ListSMSByIDs(ids)
+	if err != nil {
+		log.Printf("complete: Failed to read %d SMS: %v", len(ids), err)
+		return docs
+	}
+	stored := make(map[string]bool, len(smsList))
+	full := make(map[string]repository.SMSDocument, len(smsList))
+	for _, sms := range smsList {
+		stored[sms.ID] = true
+		doc, err := repository.NewSMSDocument(sms, sms.CreatedAt, sms.UpdatedAt)
+		if err != nil {
+			log.Printf("complete: %s for %s: %v", ErrIndexElasticsearch, sms.ID, err)
+			continue
+		}
+		full[sms.ID] = doc
+	}
+	kept := docs[:0]
+	for _, doc := range docs {
+		if doc.Partial && !stored[doc.ID] {
+			log.Printf("complete: Dropping the update of SMS %s, which is not in MySQL", doc.ID)
+			continue
+		}
+		if completed, ok := full[doc.ID]; ok && doc.Partial {
+			doc = completed
+		}
+		kept = append(kept, doc)
+	}
+	return kept
+}
+
+// persist stores documents in the backlog. If MySQL is unavailable too the
+// documents are lost to Elasticsearch; the SMS themselves are unaffected.
+func (i *SMSIndexer) persist(docs []repository.SMSDocument) {
+	if len(docs) == 0 {
+		return
+	}
+	entries := make([]models.SMSIndexBacklog, len(docs))
+	for n, doc := range docs {
+		entries[n] = models.SMSIndexBacklog{SMSID: doc.ID, Version: doc.Version, Partial: doc.Partial, Document: string(doc.Source)}
+		if !doc.Partial {
+			entries[n].Index = doc.Index
+		}
+	}
+	if err := i.db.CreateSMSIndexBacklog(entries); err != nil {
+		log.Printf("persist: Dropping %d documents that could not be indexed or stored: %v", len(docs), err)
+		return
+	}
+	log.Printf("persist: Stored %d documents in the index backlog", len(docs))
+}
+
+// drainBacklog retries the backlog every ElasticsearchBacklogEvery until the
+// indexer is closed.
+func (i *SMSIndexer) drainBacklog() {
+	ticker := time.NewTicker(config.ElasticsearchBacklogEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for i.indexBacklog() {
+			}
+		case <-i.stop:
+			return
+		}
+	}
+}
+
+// indexBacklog indexes one batch of the backlog, oldest first, and deletes
+// the rows Elasticsearch took. It reports whether a full batch was indexed,
+// so there may be more.
+func (i *SMSIndexer) indexBacklog() bool {
+	entries, err := i.db.ListSMSIndexBacklog(config.ElasticsearchBulkSize)
+	if err != nil || len(entries) == 0 {
+		return false
+	}
+
+	docs := make([]repository.SMSDocument, len(entries))
+	for n, entry := range entries {
+		docs[n] = repository.SMSDocument{ID: entry.SMSID, Index: entry.Index, Version: entry.Version, Partial: entry.Partial, Source: []byte(entry.Document)}
+	}
+	// Dropped updates are deleted from the backlog along with the indexed ones
+	docs = i.complete(docs)
+	i.locate(docs)
+	failed, err := i.es.BulkIndexSMS(docs)
+	if err != nil {
+		log.Printf("indexBacklog: Elasticsearch still unavailable, %d documents stay in the backlog: %v", len(docs), err)
+		return false
+	}
+
+	retry := make(map[string]bool, len(failed))
+	for _, doc := range failed {
+		retry[doc.ID] = true
+	}
+	var indexed []uint
+	for _, entry := range entries {
+		if !retry[entry.SMSID] {
+			indexed = append(indexed, entry.ID)
+		}
+	}
+	if err := i.db.DeleteSMSIndexBacklog(indexed); err != nil {
+		return false
+	}
+	log.Printf("indexBacklog: Indexed %d documents from the backlog", len(indexed))
+	return len(failed) == 0 && len(entries) == config.ElasticsearchBulkSize
+}
+
+// Close stops the indexer after one last attempt at the queued documents;
+// those that fail are kept in the backlog for the next start.
+func (i *SMSIndexer) Close() {
+	if !i.closed.CompareAndSwap(false, true) {
+		return
+	}
+	close(i.stop)
+	<-i.done
+}
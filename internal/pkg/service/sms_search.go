@@ -0,0 +1,176 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	config "notifications/configurations"
+	"notifications/internal/pkg/repository"
+)
+
+// Sort orders of SMS searches. A leading '-' sorts descending.
+const (
+	SortCreatedAsc  = "created_at"
+	SortCreatedDesc = "-created_at"
+	SortUpdatedAsc  = "updated_at"
+	SortUpdatedDesc = "-updated_at"
+)
+
+// Error Messages
+const (
+	ErrInvalidSort      = "sort must be one of created_at, -created_at, updated_at, -updated_at"
+	ErrInvalidPageLimit = "limit must be positive"
+	ErrInvalidTimeRange = "range start must not be after its end"
+	ErrInvalidPhonePart = "partial phone number must have 3 to 16 digits"
+)
+
+// smsHighlight asks for the matching fragments of the message, wrapped in
+// <em> tags. Terms matched on the folded subfield are highlighted too.
+var smsHighlight = json.RawMessage(`{"fields":{"message":{}},"require_field_match":false,"pre_tags":["<em>"],"post_tags":["</em>"]}`)
+
+// SMSSearch combines the filters of an SMS search. Empty fields don't filter;
+// the time ranges are inclusive and a zero bound leaves that side open.
+// PhoneNumber matches the whole number, PhoneContains any run of its digits.
+type SMSSearch struct {
+	TenantID      string
+	Text          string
+	PhoneNumber   string
+	PhoneContains string
+	Statuses      []string
+	SenderID      string
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	UpdatedFrom   time.Time
+	UpdatedTo     time.Time
+	// Sort is one of the Sort* orders, SortCreatedAsc if empty
+	Sort      string
+	Limit     int
+	Cursor    string
+	Highlight bool
+}
+
+// SMSHit is one SMS found by a search, with the highlighted fragments of the
+// message when highlighting was asked for.
+type SMSHit struct {
+	SMS       map[string]interface{} `json:"sms"`
+	Highlight map[string][]string    `json:"highlight,omitempty"`
+}
+
+// SMSSearchResult is one page of an SMS search.
+type SMSSearchResult struct {
+	Hits       []SMSHit
+	Total      int64
+	NextCursor string
+}
+
+// query returns the query clause of the search.
+func (s SMSSearch) query() (Query, error) {
+	var must, filter []Query
+	if s.Text != "" {
+		must = append(must, MessageMatch(s.Text))
+	}
+	filter = append(filter, Term("tenant_id", s.TenantID))
+	if s.PhoneNumber != "" {
+		number, err := NormalizePhoneNumber(s.PhoneNumber)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, Term("phone_number", number))
+	}
+	if s.PhoneContains != "" {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, s.PhoneContains)
+		if len(digits) < 3 || len(digits) > 16 {
+			return nil, fmt.Errorf("%w: %s", ErrValidation, ErrInvalidPhonePart)
+		}
+		filter = append(filter, Match("phone_number.ngram", digits, "and"))
+	}
+	if len(s.Statuses) > 0 {
+		filter = append(filter, Terms("status", s.Statuses...))
+	}
+	if s.SenderID != "" {
+		filter = append(filter, Term("sender_id", s.SenderID))
+	}
+	for _, r := range []struct {
+		field    string
+		from, to time.Time
+	}{
+		{"created_at", s.CreatedFrom, s.CreatedTo},
+		{"updated_at", s.UpdatedFrom, s.UpdatedTo},
+	} {
+		if r.from.IsZero() && r.to.IsZero() {
+			continue
+		}
+		if !r.from.IsZero() && !r.to.IsZero() && r.from.After(r.to) {
+			return nil, fmt.Errorf("%w: %s: %s", ErrValidation, ErrInvalidTimeRange, r.field)
+		}
+		filter = append(filter, DateRange(r.field, r.from, r.to))
+	}
+	return BoolQuery{Must: must, Filter: filter}.Query(), nil
+}
+
+// sort returns the sort clause of the search.
+func (s SMSSearch) sort() ([]map[string]string, error) {
+	switch s.Sort {
+	case "", SortCreatedAsc, SortCreatedDesc, SortUpdatedAsc, SortUpdatedDesc:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrValidation, ErrInvalidSort)
+	}
+	field := SortCreatedAsc
+	if s.Sort != "" {
+		field = s.Sort
+	}
+	return repository.SMSSort(strings.TrimPrefix(field, "-"), strings.HasPrefix(field, "-")), nil
+}
+
+// index returns the indices to search: only the period indices of the
+// creation range when it is bounded on both sides.
+func (s SMSSearch) index() string {
+	if s.CreatedFrom.IsZero() || s.CreatedTo.IsZero() {
+		return config.ElasticsearchSMSAlias
+	}
+	return repository.SMSIndexPattern(s.CreatedFrom, s.CreatedTo)
+}
+
+// SearchSMS returns one page of the SMS matching every filter of search.
+func (e *ElasticsearchService) SearchSMS(search SMSSearch) (*SMSSearchResult, error) {
+	if search.Limit <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrValidation, ErrInvalidPageLimit)
+	}
+	query, err := search.query()
+	if err != nil {
+		return nil, err
+	}
+	sort, err := search.sort()
+	if err != nil {
+		return nil, err
+	}
+
+	request := repository.SearchRequest{Sort: sort, Limit: search.Limit, Cursor: search.Cursor}
+	if search.Highlight && search.Text != "" {
+		request.Highlight = smsHighlight
+	}
+	index := search.index()
+	page, err := e.searchPage("SearchSMS", index, query, request)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SMSSearchResult{Total: page.Total, NextCursor: page.NextCursor, Hits: make([]SMSHit, len(page.Hits))}
+	for i, source := range page.Hits {
+		result.Hits[i].SMS = source
+		if i < len(page.Highlights) {
+			result.Hits[i].Highlight = page.Highlights[i]
+		}
+	}
+
+	log.Printf("SearchSMS: Retrieved %d of %d documents from index %s", len(result.Hits), result.Total, index)
+	return result, nil
+}
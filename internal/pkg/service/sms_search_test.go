@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSMSSearchQuery(t *testing.T) {
+	tenantFilter := map[string]interface{}{"term": map[string]interface{}{"tenant_id": "tenant-1"}}
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		search SMSSearch
+		want   map[string]interface{}
+	}{
+		{
+			name:   "tenant only",
+			search: SMSSearch{TenantID: "tenant-1"},
+			want: map[string]interface{}{"bool": map[string]interface{}{
+				"filter": []interface{}{tenantFilter},
+			}},
+		},
+		{
+			name:   "whole phone number",
+			search: SMSSearch{TenantID: "tenant-1", PhoneNumber: "+91 98765-43210"},
+			want: map[string]interface{}{"bool": map[string]interface{}{
+				"filter": []interface{}{
+					tenantFilter,
+					map[string]interface{}{"term": map[string]interface{}{"phone_number": "+919876543210"}},
+				},
+			}},
+		},
+		{
+			name:   "phone ngram keeps only digits",
+			search: SMSSearch{TenantID: "tenant-1", PhoneContains: "(987) 65"},
+			want: map[string]interface{}{"bool": map[string]interface{}{
+				"filter": []interface{}{
+					tenantFilter,
+					map[string]interface{}{"match": map[string]interface{}{
+						"phone_number.ngram": map[string]interface{}{"query": "98765", "operator": "and"},
+					}},
+				},
+			}},
+		},
+		{
+			name:   "time ranges",
+			search: SMSSearch{TenantID: "tenant-1", CreatedFrom: from, CreatedTo: to, UpdatedFrom: from},
+			want: map[string]interface{}{"bool": map[string]interface{}{
+				"filter": []interface{}{
+					tenantFilter,
+					map[string]interface{}{"range": map[string]interface{}{"created_at": map[string]interface{}{
+						"format": DateFormat,
+						"gte":    "2024-03-01T00:00:00Z",
+						"lte":    "2024-03-31T23:59:59Z",
+					}}},
+					map[string]interface{}{"range": map[string]interface{}{"updated_at": map[string]interface{}{
+						"format": DateFormat,
+						"gte":    "2024-03-01T00:00:00Z",
+					}}},
+				},
+			}},
+		},
+		{
+			name:   "text, statuses and sender",
+			search: SMSSearch{TenantID: "tenant-1", Text: "otp", Statuses: []string{StatusFailed, StatusQueued}, SenderID: "BANK"},
+			want: map[string]interface{}{"bool": map[string]interface{}{
+				"must": []interface{}{
+					map[string]interface{}{"multi_match": map[string]interface{}{
+						"query":    "otp",
+						"operator": "and",
+						"fields":   []interface{}{"message", "message.folded"},
+					}},
+				},
+				"filter": []interface{}{
+					tenantFilter,
+					map[string]interface{}{"terms": map[string]interface{}{"status": []interface{}{StatusFailed, StatusQueued}}},
+					map[string]interface{}{"term": map[string]interface{}{"sender_id": "BANK"}},
+				},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := tt.search.query()
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if got := decode(t, query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", mustMarshal(t, query), mustMarshal(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestSMSSearchQueryRejectsInvalidFilters(t *testing.T) {
+	tests := map[string]SMSSearch{
+		"short phone part":    {TenantID: "tenant-1", PhoneContains: "9-8"},
+		"invalid phone":       {TenantID: "tenant-1", PhoneNumber: "call me"},
+		"inverted time range": {TenantID: "tenant-1", CreatedFrom: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), CreatedTo: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for name, search := range tests {
+		if _, err := search.query(); !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: got %v, want a validation error", name, err)
+		}
+	}
+}
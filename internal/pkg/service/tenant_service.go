@@ -0,0 +1,156 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"notifications/internal/models"
+	"notifications/internal/pkg/repository"
+)
+
+// DefaultTenantID is used for requests whose API key has no tenant.
+const DefaultTenantID = "default"
+
+// Error Messages
+const (
+	ErrRetrieveTenant   = "failed to retrieve tenant"
+	ErrSaveTenant       = "failed to save tenant"
+	ErrEmptyTenantID    = "tenant ID cannot be empty"
+	ErrQuotaExceeded    = "daily SMS quota exceeded"
+	ErrSenderNotAllowed = "sender ID is not allowed for tenant"
+)
+
+// TenantFromContext returns the tenant of the authenticated client in ctx.
+func TenantFromContext(ctx context.Context) string {
+	if client, ok := ClientFromContext(ctx); ok && client.TenantID != "" {
+		return client.TenantID
+	}
+	return DefaultTenantID
+}
+
+// TenantService manages per-tenant settings: sender IDs, daily quotas and the
+// webhook notified about status changes.
+type TenantService struct {
+	db         *repository.MySQLRepo
+	httpClient *http.Client
+}
+
+func GetTenantService() *TenantService {
+	sqlDb, err := repository.GetMySqlRepository()
+	if err != nil {
+		log.Panic(err)
+	}
+	return newTenantService(sqlDb)
+}
+
+func newTenantService(db *repository.MySQLRepo) *TenantService {
+	return &TenantService{
+		db:         db,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// GetTenant returns the tenant's settings. A tenant that was never configured
+// gets the defaults: any sender ID, no quota and no webhook.
+func (t *TenantService) GetTenant(id string) (*models.Tenant, error) {
+	tenant, err := t.db.GetTenant(id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrRetrieveTenant, err)
+	}
+	if tenant == nil {
+		return &models.Tenant{ID: id}, nil
+	}
+	return tenant, nil
+}
+
+// SaveTenant creates or updates a tenant's settings.
+func (t *TenantService) SaveTenant(tenant *models.Tenant) error {
+	if tenant.ID == "" {
+		return fmt.Errorf("%w: %s", ErrValidation, ErrEmptyTenantID)
+	}
+	if err := t.db.SaveTenant(tenant); err != nil {
+		return fmt.Errorf("%s: %w", ErrSaveTenant, err)
+	}
+	return nil
+}
+
+// ApplySender fills in the tenant's default sender ID when none is given and
+// rejects sender IDs the tenant isn't allowed to use.
+func ApplySender(tenant *models.Tenant, sms *models.SMS) error {
+	allowed := splitList(tenant.SenderIDs)
+	if len(allowed) == 0 {
+		return nil
+	}
+	if sms.SenderID == "" {
+		sms.SenderID = allowed[0]
+		return nil
+	}
+	for _, sender := range allowed {
+		if sender == sms.SenderID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s %s: %s", ErrValidation, ErrSenderNotAllowed, tenant.ID, sms.SenderID)
+}
+
+// QuotaExceeded reports whether the tenant already used up today's quota.
+func (t *TenantService) QuotaExceeded(tenant *models.Tenant) (bool, error) {
+	if tenant.DailyQuota <= 0 {
+		return false, nil
+	}
+	now := time.Now().UTC().Add(5*time.Hour + 30*time.Minute)
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	count, err := t.db.CountSMSSince(tenant.ID, startOfDay)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", ErrRetrieveTenant, err)
+	}
+	if count >= int64(tenant.DailyQuota) {
+		log.Printf("QuotaExceeded: %s for tenant %s (%d)", ErrQuotaExceeded, tenant.ID, tenant.DailyQuota)
+		return true, nil
+	}
+	return false, nil
+}
+
+// NotifyStatus posts the SMS's new status to the tenant's webhook, if one is
+// configured. It runs in the background and only logs failures.
+func (t *TenantService) NotifyStatus(sms models.SMS) {
+	tenant, err := t.GetTenant(sms.TenantID)
+	if err != nil {
+		log.Printf("NotifyStatus: %v", err)
+		return
+	}
+	if strings.TrimSpace(tenant.WebhookURL) == "" {
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":               sms.ID,
+		"tenant_id":        sms.TenantID,
+		"phone_number":     sms.PhoneNumber,
+		"sender_id":        sms.SenderID,
+		"status":           sms.Status,
+		"failure_comments": sms.FailureComments,
+	})
+	if err != nil {
+		log.Printf("NotifyStatus: Failed to encode webhook payload for %s: %v", sms.ID, err)
+		return
+	}
+
+	go func() {
+		res, err := t.httpClient.Post(tenant.WebhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("NotifyStatus: Webhook call for SMS %s failed: %v", sms.ID, err)
+			return
+		}
+		defer res.Body.Close()
+		if res.StatusCode >= 300 {
+			log.Printf("NotifyStatus: Webhook for SMS %s returned status %d", sms.ID, res.StatusCode)
+		}
+	}()
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"os"
+
 	initialize "notifications/initiations"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		os.Exit(initialize.RunBackfill(os.Args[2:]))
+	}
 	initialize.StartServer()
 }